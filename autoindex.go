@@ -0,0 +1,293 @@
+package kvt
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// struct tag to declare indexes on fields, a field can join several indexes:
+//
+//	Type   string `kvt:"idx_Type_Status:0,idx_Type"`
+//	Status uint16 `kvt:"idx_Type_Status:1"`
+//	Email  string `kvt:"idx_Email:unique"`
+//	Tags   []string `kvt:"midx_Tags"`
+//	Birth  time.Time `kvt:"idx_Type_Birth:1:desc"`
+//
+// the number option is the field position in the index, default is the struct field order,
+// desc option store the field in descending order.
+// index declared by tag, or without a hand-written Index(), KVT generate its key from
+// the fields with the order preserving encoders, slice/array field of a mindex generate one key per element
+const tagName = "kvt"
+
+const errTagInvalid = "kvt tag invalid: [%s] of field [%s]"
+const errFieldNotEncodable = "index field not encodable: [%s] of index [%s]"
+
+// optional, a KVer implement it to generate the index key by hand
+type Indexer interface {
+	Index(string) ([]byte, error)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var indexerType = reflect.TypeOf((*Indexer)(nil)).Elem()
+
+// check a field type can be encoded by the order preserving encoders
+func encodableType(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
+// mindex field can be a slice/array of encodable type
+func encodableMultiType(t reflect.Type) bool {
+	if encodableType(t) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return encodableType(t.Elem())
+	}
+	return false
+}
+
+// encode a field value, named type use its underlying kind
+func encodeReflect(v reflect.Value) ([]byte, error) {
+	if v.Type() == timeType {
+		return EncodeTime(v.Interface().(time.Time)), nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return EncodeBool(v.Bool()), nil
+	case reflect.String:
+		return EncodeString(v.String()), nil
+	case reflect.Int8:
+		return EncodeInt8(int8(v.Int())), nil
+	case reflect.Int16:
+		return EncodeInt16(int16(v.Int())), nil
+	case reflect.Int32:
+		return EncodeInt32(int32(v.Int())), nil
+	case reflect.Int, reflect.Int64:
+		return EncodeInt64(v.Int()), nil
+	case reflect.Uint8:
+		return EncodeUint8(uint8(v.Uint())), nil
+	case reflect.Uint16:
+		return EncodeUint16(uint16(v.Uint())), nil
+	case reflect.Uint32:
+		return EncodeUint32(uint32(v.Uint())), nil
+	case reflect.Uint, reflect.Uint64:
+		return EncodeUint64(v.Uint()), nil
+	case reflect.Float32:
+		return EncodeFloat32(float32(v.Float())), nil
+	case reflect.Float64:
+		return EncodeFloat64(v.Float()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return EncodeBytes(v.Bytes()), nil
+		}
+	}
+	return nil, fmt.Errorf(errEncodeTypeInvalid, v.Interface())
+}
+
+func structValue(obj any) reflect.Value {
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	return v
+}
+
+// generate the index key from the obj fields
+func autoIndexKey(obj any, index *IndexInfo) ([]byte, error) {
+	v := structValue(obj)
+	key := make([]byte, 0, 20)
+	for i := range index.Fields {
+		fv := v.FieldByName(index.Fields[i])
+		if !fv.IsValid() {
+			return nil, fmt.Errorf(errIndexFieldMismatch, index.Name)
+		}
+		b, err := encodeReflect(fv)
+		if err != nil {
+			return nil, err
+		}
+		key = MakeIndexKey(key, b)
+	}
+	return key, nil
+}
+
+// encode a field value, slice/array field expands to its elements
+func encodeMultiReflect(fv reflect.Value) (values [][]byte, err error) {
+	if (fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array) && !encodableType(fv.Type()) {
+		for j := 0; j < fv.Len(); j++ {
+			b, err := encodeReflect(fv.Index(j))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, b)
+		}
+		return values, nil
+	}
+	b, err := encodeReflect(fv)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{b}, nil
+}
+
+// generate the mindex keys from the obj fields, slice/array field expands to its elements
+func autoMIndexKeys(obj any, index *IndexInfo) ([][]byte, error) {
+	v := structValue(obj)
+	keys := [][]byte{make([]byte, 0, 20)}
+	for i := range index.Fields {
+		fv := v.FieldByName(index.Fields[i])
+		if !fv.IsValid() {
+			return nil, fmt.Errorf(errIndexFieldMismatch, index.Name)
+		}
+		values, err := encodeMultiReflect(fv)
+		if err != nil {
+			return nil, err
+		}
+
+		next := make([][]byte, 0, len(keys)*len(values))
+		for _, k := range keys {
+			for _, b := range values {
+				next = append(next, MakeIndexKey(append([]byte{}, k...), b))
+			}
+		}
+		keys = next
+	}
+	return keys, nil
+}
+
+type tagField struct {
+	pos    int
+	order  int
+	name   string
+	unique bool
+	desc   bool
+}
+
+// collect the indexes declared by the kvt tag
+func parseTags(obj any) (indexs []IndexInfo, mindexs []MIndex, err error) {
+	t := reflect.TypeOf(obj)
+	found := make(map[string][]tagField)
+	names := make([]string, 0)
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup(tagName)
+		if !ok {
+			continue
+		}
+		for _, entry := range strings.Split(tag, ",") {
+			entry = strings.TrimSpace(entry)
+			if len(entry) == 0 {
+				continue
+			}
+			opts := strings.Split(entry, ":")
+			tf := tagField{pos: i, order: i, name: field.Name}
+			for _, opt := range opts[1:] {
+				if n, err := strconv.Atoi(opt); err == nil {
+					tf.pos = n
+					continue
+				}
+				switch opt {
+				case "unique":
+					tf.unique = true
+				case "desc":
+					tf.desc = true
+				default:
+					return nil, nil, fmt.Errorf(errTagInvalid, entry, field.Name)
+				}
+			}
+			name := opts[0]
+			if _, ok := found[name]; !ok {
+				names = append(names, name)
+			}
+			found[name] = append(found[name], tf)
+		}
+	}
+
+	for _, name := range names {
+		tfs := found[name]
+		sort.SliceStable(tfs, func(i, j int) bool {
+			if tfs[i].pos != tfs[j].pos {
+				return tfs[i].pos < tfs[j].pos
+			}
+			return tfs[i].order < tfs[j].order
+		})
+		info := IndexInfo{Name: name, auto: true}
+		for i := range tfs {
+			info.Fields = append(info.Fields, tfs[i].name)
+			info.Unique = info.Unique || tfs[i].unique
+			if tfs[i].desc {
+				info.Desc = append(info.Desc, tfs[i].name)
+			}
+		}
+		idxName, _, _ := splitPath(name)
+		switch {
+		case strings.HasPrefix(idxName, IDXPrefix):
+			indexs = append(indexs, info)
+		case strings.HasPrefix(idxName, MIDXPrefix):
+			mindexs = append(mindexs, MIndex{IndexInfo: &info})
+		default:
+			return nil, nil, fmt.Errorf(errIndexNameInvalid, name)
+		}
+	}
+	return indexs, mindexs, nil
+}
+
+func checkFieldsEncodable(t reflect.Type, index *IndexInfo, encodable func(reflect.Type) bool) error {
+	for _, name := range index.Fields {
+		if f, ok := t.FieldByName(name); !ok || !encodable(f.Type) {
+			return fmt.Errorf(errFieldNotEncodable, name, index.Name)
+		}
+	}
+	return nil
+}
+
+// make sure the auto generated index fields are encodable, tag declared indexs are always auto generated
+func (kvt *KVT) checkIndexsEncodable(obj any, tagIndexs []IndexInfo) error {
+	t := reflect.TypeOf(obj)
+	for i := range tagIndexs {
+		if err := checkFieldsEncodable(t, &tagIndexs[i], encodableType); err != nil {
+			return err
+		}
+	}
+	if !t.Implements(indexerType) && !reflect.PointerTo(t).Implements(indexerType) {
+		for _, index := range kvt.indexs {
+			if err := checkFieldsEncodable(t, index, encodableType); err != nil {
+				return err
+			}
+		}
+	}
+	for _, mindex := range kvt.mindexs {
+		if err := checkCoverEncodable(t, mindex.IndexInfo); err != nil {
+			return err
+		}
+		if mindex.Key != nil {
+			continue
+		}
+		if err := checkFieldsEncodable(t, mindex.IndexInfo, encodableMultiType); err != nil {
+			return err
+		}
+	}
+	for _, index := range kvt.indexs {
+		if err := checkCoverEncodable(t, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,10 +4,13 @@
 package kvt
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 	"unsafe"
@@ -1079,3 +1082,3036 @@ func Test_BucketPath(t *testing.T) {
 	initkvt("a/b/bkt_Order13", "a/b/idx_Type_Status", "idx_Type_Status", []string{})
 	initkvt("a/b/bkt_Order14", "bkt_Order14/idx_Type_Status", "idx_Type_Status", []string{})
 }
+
+func Test_uniqueIndex(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	kp := KVTParam{
+		Bucket:    "Bucket_Order",
+		Unmarshal: orderUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_Status", Unique: true},
+		},
+	}
+
+	k, err := New(order{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		return nil
+	})
+
+	odInputs := []order{
+		order{
+			Type:     "book",
+			Status:   1,
+			Name:     "Alice",
+			District: "East ST",
+		},
+		order{
+			Type:     "fruit",
+			Status:   2,
+			Name:     "Bob",
+			District: "South ST",
+		},
+	}
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		for i := range odInputs {
+			odInputs[i].ID, _ = k.NextSequence(p)
+			if err = k.Put(p, &odInputs[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+				return err
+			}
+		}
+		return nil
+	})
+
+	//update self with the same unique value is ok
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		odInputs[0].Name = "Jack"
+		if err := k.Put(p, &odInputs[0]); err != nil {
+			t.Errorf("update self fail: %s", err)
+		}
+		return nil
+	})
+
+	//another order with Status 2 should be rejected
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		od := order{Type: "book", Status: 2, Name: "Carl"}
+		od.ID, _ = k.NextSequence(p)
+		err := k.Put(p, &od)
+		var ue *UniqueError
+		if !errors.As(err, &ue) {
+			t.Errorf("should got unique error: %v", err)
+			return nil
+		}
+		if ue.Index != "idx_Status" || !reflect.DeepEqual(ue.Key, Bytes(Ptr(&odInputs[1].ID), unsafe.Sizeof(odInputs[1].ID))) {
+			t.Errorf("unique error info mismatch: %v", ue)
+		}
+		if _, err := k.Get(p, &od, nil); err == nil {
+			t.Errorf("rejected obj should not be saved")
+		}
+		return nil
+	})
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		var out order
+		_, err := k.GetUnique(p, QueryInfo{
+			IndexName: "idx_Status",
+			Where: map[string][]byte{
+				"Status": Bytes(Ptr(&odInputs[0].Status), unsafe.Sizeof(odInputs[0].Status)),
+			},
+		}, &out)
+		if err != nil || !reflect.DeepEqual(out, odInputs[0]) {
+			t.Errorf("get unique fail: %v %v", err, out)
+		}
+
+		s := uint16(9)
+		_, err = k.GetUnique(p, QueryInfo{
+			IndexName: "idx_Status",
+			Where:     map[string][]byte{"Status": Bytes(Ptr(&s), unsafe.Sizeof(s))},
+		}, nil)
+		if err == nil || err.Error() != ErrDataNotFound {
+			t.Errorf("should not found: %v", err)
+		}
+		return nil
+	})
+}
+
+func Test_rebuildIndex(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	kp := KVTParam{
+		Bucket:    "Bucket_Order",
+		Unmarshal: orderUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_Status"},
+		},
+	}
+
+	k, err := New(order{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		return nil
+	})
+
+	odInputs := []order{
+		order{Type: "book", Status: 1, Name: "Alice", District: "East ST"},
+		order{Type: "fruit", Status: 2, Name: "Bob", District: "South ST"},
+		order{Type: "fruit", Status: 3, Name: "Carl", District: "West ST"},
+		order{Type: "book", Status: 2, Name: "Dicken", District: "East ST"},
+		order{Type: "fruit", Status: 4, Name: "Frank", District: "East ST"},
+	}
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		for i := range odInputs {
+			odInputs[i].ID, _ = k.NextSequence(p)
+			if err = k.Put(p, &odInputs[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		return nil
+	})
+
+	//add a new index on the table which has data
+	kp.Indexs = append(kp.Indexs, IndexInfo{Name: "idx_Type_Status_District"})
+	k, err = New(order{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.CreateIndexBuckets(p)
+		return nil
+	})
+
+	qi := QueryInfo{
+		IndexName: "idx_Type_Status_District",
+		Where: map[string][]byte{
+			"Type": []byte("fruit"),
+		},
+	}
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		r, _ := k.Query(p, qi)
+		if len(r) != 0 {
+			t.Errorf("new index should be empty before rebuild: %d", len(r))
+		}
+		return nil
+	})
+
+	//rebuild in chunks, 2 records every transaction
+	var last []byte
+	chunks, done := 0, 0
+	for {
+		bdb.Update(func(tx *bolt.Tx) error {
+			p, _ := NewPoler(tx)
+			cp := &countPoler{Poler: p}
+			last, err = k.RebuildChunk(cp, RebuildInfo{
+				Indexs:   []string{"idx_Type_Status_District"},
+				After:    last,
+				Limit:    2,
+				Progress: func(d, total int) { done++ },
+			})
+			if cp.scanned > 3 { //the chunk and one more to know it's not the last
+				t.Errorf("rebuild chunk should scan the chunk only: %d", cp.scanned)
+			}
+			return err
+		})
+		chunks++
+		if err != nil {
+			t.Errorf("rebuild fail: %s", err)
+			return
+		}
+		if last == nil {
+			break
+		}
+	}
+	if chunks != 3 || done != len(odInputs) {
+		t.Errorf("rebuild chunks mismatch: %d %d", chunks, done)
+	}
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		r, err := k.Query(p, qi)
+		if err != nil || len(r) != 3 {
+			t.Errorf("query after rebuild fail: %v %d", err, len(r))
+		}
+		return nil
+	})
+
+	//rebuild all again should not duplicate index
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		if err := k.RebuildIndexes(p); err != nil {
+			t.Errorf("rebuild all fail: %s", err)
+		}
+		return nil
+	})
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		r, err := k.Query(p, qi)
+		if err != nil || len(r) != 3 {
+			t.Errorf("query after rebuild all fail: %v %d", err, len(r))
+		}
+		s := uint16(2)
+		r, err = k.Query(p, QueryInfo{IndexName: "idx_Status", Where: map[string][]byte{"Status": Bytes(Ptr(&s), unsafe.Sizeof(s))}})
+		if err != nil || len(r) != 2 {
+			t.Errorf("query idx_Status after rebuild all fail: %v %d", err, len(r))
+		}
+		return nil
+	})
+}
+
+func Test_verifyRepair(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	kp := KVTParam{
+		Bucket:    "Bucket_Order",
+		Unmarshal: orderUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_Status"},
+		},
+	}
+
+	k, err := New(order{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		return nil
+	})
+
+	odInputs := []order{
+		order{Type: "book", Status: 1, Name: "Alice", District: "East ST"},
+		order{Type: "fruit", Status: 2, Name: "Bob", District: "South ST"},
+		order{Type: "fruit", Status: 3, Name: "Carl", District: "West ST"},
+	}
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		for i := range odInputs {
+			odInputs[i].ID, _ = k.NextSequence(p)
+			if err = k.Put(p, &odInputs[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		return nil
+	})
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		r, err := k.Verify(p)
+		if err != nil || !r.OK() || r.Records != 3 || r.IndexKeys != 3 {
+			t.Errorf("verify fail: %v %v", err, r)
+		}
+		return nil
+	})
+
+	//make index bucket drift from data bucket
+	path := k.indexs["idx_Status"].path
+	pk0 := Bytes(Ptr(&odInputs[0].ID), unsafe.Sizeof(odInputs[0].ID))
+	pk1 := Bytes(Ptr(&odInputs[1].ID), unsafe.Sizeof(odInputs[1].ID))
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		ik, _ := odInputs[0].Index("idx_Status")
+		p.Delete(path, AppendLastKey(ik, pk0)) //missing
+
+		id := uint64(9999)
+		pk := Bytes(Ptr(&id), unsafe.Sizeof(id))
+		p.Put(path, AppendLastKey(ik, pk), pk) //orphan
+
+		s := uint16(7)
+		ik = MakeIndexKey(nil, Bytes(Ptr(&s), unsafe.Sizeof(s)))
+		p.Put(path, AppendLastKey(ik, pk1), pk1) //stale
+		return nil
+	})
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		r, err := k.Repair(p)
+		if err != nil || len(r.Issues) != 3 || !r.Repaired {
+			t.Errorf("repair fail: %v %v", err, r)
+			return nil
+		}
+		kinds := map[IssueKind]int{}
+		for _, v := range r.Issues {
+			kinds[v.Kind]++
+		}
+		if kinds[IssueOrphan] != 1 || kinds[IssueMissing] != 1 || kinds[IssueStale] != 1 {
+			t.Errorf("repair issue kinds mismatch: %v", kinds)
+		}
+		return nil
+	})
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		r, err := k.Verify(p)
+		if err != nil || !r.OK() {
+			t.Errorf("verify after repair fail: %v %v", err, r)
+		}
+		return nil
+	})
+}
+
+func Test_tagIndex(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	type invalid struct {
+		ID   uint64
+		Data map[string]int `kvt:"idx_Data"`
+	}
+	if _, err := New(invalid{}, &KVTParam{Bucket: "Bucket_Invalid"}); err == nil {
+		t.Errorf("index on unencodable field should fail")
+	}
+
+	kp := KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+	if !reflect.DeepEqual(k.indexs["idx_Level_Name"].Fields, []string{"Level", "Name"}) || !k.indexs["idx_Email"].Unique {
+		t.Errorf("tag index parse fail: %v", k.indexs["idx_Level_Name"])
+	}
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		return nil
+	})
+
+	ms := []member{
+		member{Email: "alice@a.com", Name: "Alice", Level: -1, Score: -2.5, Tags: []string{"aa", "xyz"}},
+		member{Email: "bob@a.com", Name: "Bob", Level: 2, Score: 0.5, Tags: []string{"bb"}},
+		member{Email: "carl@a.com", Name: "Carl", Level: 2, Score: 300, Tags: []string{"cc", "xyz"}},
+		member{Email: "dick@a.com", Name: "Dick", Level: 256, Score: -0.5},
+	}
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		for i := range ms {
+			ms[i].ID, _ = k.NextSequence(p)
+			if err := k.Put(p, &ms[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		dup := member{ID: 9999, Email: ms[0].Email}
+		var ue *UniqueError
+		if err := k.Put(p, &dup); !errors.As(err, &ue) {
+			t.Errorf("duplicate email should fail: %v", err)
+		}
+		return nil
+	})
+
+	cmpResult := func(result []any, err error, ids ...uint64) {
+		if err != nil || len(result) != len(ids) {
+			t.Errorf("got query result fail %v %d %d", err, len(result), len(ids))
+			return
+		}
+		found := make(map[uint64]bool)
+		for i := range result {
+			found[result[i].(*member).ID] = true
+		}
+		for _, id := range ids {
+			if !found[id] {
+				t.Errorf("not found id %d", id)
+			}
+		}
+	}
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		//negative and float values should sort numerically
+		r, err := k.RangeQuery(p, RangeInfo{
+			IndexName: "idx_Score",
+			Where: map[string]map[string][]byte{
+				"Score": {">": EncodeFloat64(-1), "<": EncodeFloat64(100)},
+			},
+		})
+		cmpResult(r, err, ms[1].ID, ms[3].ID)
+
+		r, err = k.RangeQuery(p, RangeInfo{
+			IndexName: "idx_Level_Name",
+			Where: map[string]map[string][]byte{
+				"Level": {">=": EncodeInt64(0)},
+			},
+		})
+		cmpResult(r, err, ms[1].ID, ms[2].ID, ms[3].ID)
+
+		r, err = k.Query(p, QueryInfo{
+			IndexName: "idx_Level_Name",
+			Where: map[string][]byte{
+				"Level": EncodeInt64(2),
+				"Name":  EncodeString("Carl"),
+			},
+		})
+		cmpResult(r, err, ms[2].ID)
+
+		r, err = k.Query(p, QueryInfo{
+			IndexName: "midx_Tags",
+			Where:     map[string][]byte{"Tags": EncodeString("xyz")},
+		})
+		cmpResult(r, err, ms[0].ID, ms[2].ID)
+
+		var out member
+		if _, err := k.GetUnique(p, QueryInfo{
+			IndexName: "idx_Email",
+			Where:     map[string][]byte{"Email": EncodeString("bob@a.com")},
+		}, &out); err != nil || out.ID != ms[1].ID {
+			t.Errorf("get by email fail: %v %v", err, out)
+		}
+		return nil
+	})
+
+	//update the tags, old mindex keys should be removed
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		ms[2].Tags = []string{"cc"}
+		return k.Put(p, &ms[2])
+	})
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		r, err := k.Query(p, QueryInfo{
+			IndexName: "midx_Tags",
+			Where:     map[string][]byte{"Tags": EncodeString("xyz")},
+		})
+		cmpResult(r, err, ms[0].ID)
+
+		report, err := k.Verify(p)
+		if err != nil || !report.OK() {
+			t.Errorf("verify tag index fail: %v %v", err, report)
+		}
+		return nil
+	})
+
+	//the tag declared index never calls the hand-written Index(), and its errors are returned
+	hand, err := New(tagged{}, &KVTParam{Bucket: "Bucket_Tagged", Indexs: []IndexInfo{{Name: "idx_Code", Fields: []string{"Code"}}}})
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		hand.CreateDataBucket(p)
+		hand.CreateIndexBuckets(p)
+		if err := hand.Put(p, &tagged{ID: 1, Name: "ann", Code: "a1"}); err != nil {
+			t.Errorf("put kvt fail: %s", err)
+		}
+		if err := hand.Put(p, &tagged{ID: 2, Name: "bob"}); err == nil {
+			t.Errorf("the error of Index() should be returned")
+		}
+		r, err := hand.Query(p, QueryInfo{IndexName: "idx_Name", Where: map[string][]byte{"Name": EncodeString("ann")}})
+		if err != nil || len(r) != 1 {
+			t.Errorf("tag index should be generated from the fields: %v %v", r, err)
+		}
+		r, err = hand.Query(p, QueryInfo{IndexName: "idx_Code", Where: map[string][]byte{"Code": EncodeString("code-a1")}})
+		if err != nil || len(r) != 1 {
+			t.Errorf("query hand-written index fail: %v %v", r, err)
+		}
+
+		//Find never chooses the hand-written index, its encoding differs from the fields
+		r, plan, err := hand.Find(p, map[string]map[string][]byte{"Code": {"=": EncodeString("a1")}})
+		if err != nil || len(r) != 1 || !plan.FullScan() {
+			t.Errorf("find should scan instead of the hand-written index: %v %v %v", r, plan, err)
+		}
+		r, plan, err = hand.Find(p, map[string]map[string][]byte{"Name": {"=": EncodeString("ann")}, "Code": {"=": EncodeString("a1")}})
+		if err != nil || len(r) != 1 || plan.IndexName != "idx_Name" {
+			t.Errorf("find should use the tag declared index: %v %v %v", r, plan, err)
+		}
+		if r, _ := hand.Gets(p, nil); len(r) != 1 {
+			t.Errorf("the failed put should write nothing: %v", r)
+		}
+		return nil
+	})
+
+	//another table declaring the same tag indexs has its own index buckets
+	staff, err := New(member{}, &KVTParam{Bucket: "Bucket_Staff", Unmarshal: memberUnmarshal})
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		staff.CreateDataBucket(p)
+		staff.CreateIndexBuckets(p)
+		if err := staff.Put(p, &member{ID: 1, Email: ms[1].Email, Name: ms[1].Name, Level: ms[1].Level}); err != nil {
+			t.Errorf("same email in another table should not conflict: %s", err)
+		}
+		r, err := staff.Query(p, QueryInfo{IndexName: "idx_Email", Where: map[string][]byte{"Email": EncodeString(ms[1].Email)}})
+		cmpResult(r, err, 1)
+		r, err = k.Query(p, QueryInfo{IndexName: "idx_Email", Where: map[string][]byte{"Email": EncodeString(ms[1].Email)}})
+		cmpResult(r, err, ms[1].ID)
+
+		//rebuild and repair of one table keep the index keys of the other
+		if err := staff.RebuildIndexes(p); err != nil {
+			t.Errorf("rebuild index fail: %s", err)
+		}
+		if _, err := staff.Repair(p); err != nil {
+			t.Errorf("repair fail: %s", err)
+		}
+		for _, kt := range []*KVT{k, staff} {
+			if report, err := kt.Verify(p); err != nil || !report.OK() {
+				t.Errorf("verify %s fail: %v %v", kt.bucket, err, report)
+			}
+		}
+		r, err = k.Query(p, QueryInfo{IndexName: "idx_Level_Name", Where: map[string][]byte{"Level": EncodeInt64(2), "Name": EncodeString("Bob")}})
+		cmpResult(r, err, ms[1].ID)
+		return nil
+	})
+}
+
+func Test_descIndex(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	kp := KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_Level_Score", Fields: []string{"Level", "Score"}, Desc: []string{"Score"}},
+			{Name: "idx_Name", Desc: []string{"Name"}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		return nil
+	})
+
+	ms := []member{
+		member{Email: "alice@a.com", Name: "Al", Level: 2, Score: -2.5},
+		member{Email: "bob@a.com", Name: "Bob", Level: 2, Score: 0.5},
+		member{Email: "carl@a.com", Name: "Alice", Level: 2, Score: 300},
+		member{Email: "dick@a.com", Name: "Dick", Level: 3, Score: 1000},
+	}
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		for i := range ms {
+			ms[i].ID, _ = k.NextSequence(p)
+			if err := k.Put(p, &ms[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		return nil
+	})
+
+	cmpOrder := func(result []any, err error, ids ...uint64) {
+		if err != nil || len(result) != len(ids) {
+			t.Errorf("got query result fail %v %d %d", err, len(result), len(ids))
+			return
+		}
+		for i := range result {
+			if result[i].(*member).ID != ids[i] {
+				t.Errorf("result order mismatch at %d: %d %d", i, result[i].(*member).ID, ids[i])
+			}
+		}
+	}
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		//latest score first
+		r, err := k.Query(p, QueryInfo{
+			IndexName: "idx_Level_Score",
+			Where:     map[string][]byte{"Level": EncodeInt64(2)},
+		})
+		cmpOrder(r, err, ms[2].ID, ms[1].ID, ms[0].ID)
+
+		//compare operator keep its meaning on the descending field
+		r, err = k.RangeQuery(p, RangeInfo{
+			IndexName: "idx_Level_Score",
+			Where: map[string]map[string][]byte{
+				"Level": {"=": EncodeInt64(2)},
+				"Score": {">": EncodeFloat64(0)},
+			},
+		})
+		cmpOrder(r, err, ms[2].ID, ms[1].ID)
+
+		r, err = k.Query(p, QueryInfo{
+			IndexName: "idx_Level_Score",
+			Where:     map[string][]byte{"Level": EncodeInt64(2), "Score": EncodeFloat64(0.5)},
+		})
+		cmpOrder(r, err, ms[1].ID)
+
+		//variable length value, longer one first
+		r, err = k.RangeQuery(p, RangeInfo{
+			IndexName: "idx_Name",
+			Where: map[string]map[string][]byte{
+				"Name": {">=": EncodeString("Al")},
+			},
+		})
+		cmpOrder(r, err, ms[3].ID, ms[1].ID, ms[2].ID, ms[0].ID)
+		return nil
+	})
+
+	//the values differ only by the trailing 0x00
+	zero := member{Email: "zero@a.com", Name: "Al\x00", Level: 1}
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		zero.ID, _ = k.NextSequence(p)
+		return k.Put(p, &zero)
+	})
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		r, err := k.RangeQuery(p, RangeInfo{IndexName: "idx_Name", Where: map[string]map[string][]byte{"Name": {">=": EncodeString("Al")}}})
+		cmpOrder(r, err, ms[3].ID, ms[1].ID, ms[2].ID, zero.ID, ms[0].ID)
+		r, err = k.RangeQuery(p, RangeInfo{IndexName: "idx_Name", Where: map[string]map[string][]byte{"Name": {"<=": EncodeString("Al\x00")}}})
+		cmpOrder(r, err, zero.ID, ms[0].ID)
+		r, err = k.RangeQuery(p, RangeInfo{IndexName: "idx_Name", Where: map[string]map[string][]byte{"Name": {"<": EncodeString("Al\x00")}}})
+		cmpOrder(r, err, ms[0].ID)
+		r, err = k.RangeQuery(p, RangeInfo{IndexName: "idx_Name", Where: map[string]map[string][]byte{"Name": {"prefix": EncodeString("Al")}}})
+		cmpOrder(r, err, ms[2].ID, zero.ID, ms[0].ID)
+		r, err = k.Query(p, QueryInfo{IndexName: "idx_Name", Where: map[string][]byte{"Name": EncodeString("Al")}})
+		cmpOrder(r, err, ms[0].ID)
+		return nil
+	})
+
+	type invalid struct {
+		ID   uint64
+		Name string
+	}
+	if _, err := New(invalid{}, &KVTParam{Bucket: "Bucket_Invalid", Indexs: []IndexInfo{{Name: "idx_Name", Desc: []string{"ID"}}}}); err == nil {
+		t.Errorf("desc field out of index should fail")
+	}
+}
+
+func Test_queryOrderLimit(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	kp := KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_Level_Score", Fields: []string{"Level", "Score"}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		return nil
+	})
+
+	ms := make([]member, 10)
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		for i := range ms {
+			ms[i].ID, _ = k.NextSequence(p)
+			ms[i].Email = fmt.Sprintf("%d@a.com", i)
+			ms[i].Level = 1 + i%2
+			ms[i].Score = float64(i)
+			if err := k.Put(p, &ms[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		return nil
+	})
+
+	cmpOrder := func(result []any, err error, ids ...uint64) {
+		if err != nil || len(result) != len(ids) {
+			t.Errorf("got query result fail %v %d %d", err, len(result), len(ids))
+			return
+		}
+		for i := range result {
+			if result[i].(*member).ID != ids[i] {
+				t.Errorf("result order mismatch at %d: %d %d", i, result[i].(*member).ID, ids[i])
+			}
+		}
+	}
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		cp := &countPoler{Poler: p}
+
+		//Level 2 has Score 1, 3, 5, 7, 9
+		r, err := k.RangeQuery(cp, RangeInfo{
+			IndexName: "idx_Level_Score",
+			Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(2)}},
+			Limit:     2,
+		})
+		cmpOrder(r, err, ms[1].ID, ms[3].ID)
+		if cp.scanned != 2 {
+			t.Errorf("scan should stop after limit: %d", cp.scanned)
+		}
+
+		r, err = k.RangeQuery(p, RangeInfo{
+			IndexName: "idx_Level_Score",
+			Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(2)}},
+			Reverse:   true,
+			Offset:    1,
+			Limit:     3,
+		})
+		cmpOrder(r, err, ms[7].ID, ms[5].ID, ms[3].ID)
+
+		//filter and offset together
+		r, err = k.RangeQuery(p, RangeInfo{
+			IndexName: "idx_Level_Score",
+			Where: map[string]map[string][]byte{
+				"Score": {">=": EncodeFloat64(4)},
+			},
+			Reverse: true,
+			Offset:  2,
+		})
+		cmpOrder(r, err, ms[5].ID, ms[8].ID, ms[6].ID, ms[4].ID)
+
+		//the last level in reverse order
+		r, err = k.RangeQuery(p, RangeInfo{
+			IndexName: "idx_Level_Score",
+			Reverse:   true,
+			Limit:     1,
+		})
+		cmpOrder(r, err, ms[9].ID)
+		return nil
+	})
+}
+
+func Test_queryPage(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	kp := KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_Level_Score", Fields: []string{"Level", "Score"}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		return nil
+	})
+
+	put := func(level int, score float64) member {
+		m := member{Level: level, Score: score}
+		bdb.Update(func(tx *bolt.Tx) error {
+			p, _ := NewPoler(tx)
+			m.ID, _ = k.NextSequence(p)
+			m.Email = fmt.Sprintf("%d@a.com", m.ID)
+			return k.Put(p, &m)
+		})
+		return m
+	}
+	ms := make([]member, 0)
+	for i := range 7 {
+		ms = append(ms, put(1, float64(i*10)))
+	}
+	put(2, 0)
+
+	page := func(rangeInfo RangeInfo) (ids []uint64, cursor string) {
+		bdb.View(func(tx *bolt.Tx) error {
+			p, _ := NewPoler(tx)
+			r, c, err := k.RangeQueryPage(p, rangeInfo)
+			if err != nil {
+				t.Errorf("query page fail: %s", err)
+			}
+			for i := range r {
+				ids = append(ids, r[i].(*member).ID)
+			}
+			cursor = c
+			return nil
+		})
+		return ids, cursor
+	}
+
+	rqi := RangeInfo{
+		IndexName: "idx_Level_Score",
+		Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(1)}},
+		Limit:     3,
+	}
+	ids, cursor := page(rqi)
+	if !reflect.DeepEqual(ids, []uint64{ms[0].ID, ms[1].ID, ms[2].ID}) || cursor == "" {
+		t.Errorf("page 1 mismatch: %v %s", ids, cursor)
+	}
+
+	//insert a record before the cursor, next page should not change
+	put(1, 5)
+	rqi.Cursor = cursor
+	ids, cursor = page(rqi)
+	if !reflect.DeepEqual(ids, []uint64{ms[3].ID, ms[4].ID, ms[5].ID}) || cursor == "" {
+		t.Errorf("page 2 mismatch: %v %s", ids, cursor)
+	}
+	rqi.Cursor = cursor
+	ids, cursor = page(rqi)
+	if !reflect.DeepEqual(ids, []uint64{ms[6].ID}) || cursor != "" {
+		t.Errorf("last page mismatch: %v %s", ids, cursor)
+	}
+
+	//reverse pages
+	rqi = RangeInfo{
+		IndexName: "idx_Level_Score",
+		Where:     map[string]map[string][]byte{"Score": {">=": EncodeFloat64(30)}},
+		Reverse:   true,
+		Limit:     2,
+	}
+	ids, cursor = page(rqi)
+	if !reflect.DeepEqual(ids, []uint64{ms[6].ID, ms[5].ID}) || cursor == "" {
+		t.Errorf("reverse page 1 mismatch: %v %s", ids, cursor)
+	}
+	rqi.Cursor = cursor
+	ids, cursor = page(rqi)
+	if !reflect.DeepEqual(ids, []uint64{ms[4].ID, ms[3].ID}) || cursor != "" {
+		t.Errorf("reverse page 2 mismatch: %v %s", ids, cursor)
+	}
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		r, c, err := k.QueryPage(p, QueryInfo{
+			IndexName: "idx_Level_Score",
+			Where:     map[string][]byte{"Level": EncodeInt64(2)},
+			Limit:     1,
+		})
+		if err != nil || len(r) != 1 || c != "" {
+			t.Errorf("query page fail: %v %d %s", err, len(r), c)
+		}
+
+		_, _, err = k.RangeQueryPage(p, RangeInfo{IndexName: "idx_Level_Score", Cursor: "bad cursor"})
+		if err == nil {
+			t.Errorf("invalid cursor should fail")
+		}
+		return nil
+	})
+
+	//a record failed to decode is skipped, the next page should not repeat the last obj returned
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		return p.Put(k.path, EncodeUint64(ms[1].ID), []byte("bad"))
+	})
+	rqi = RangeInfo{
+		IndexName: "idx_Level_Score",
+		Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(1)}},
+		Limit:     3,
+	}
+	ids, cursor = page(rqi)
+	if len(ids) != 3 || ids[0] != ms[0].ID || ids[2] != ms[2].ID || cursor == "" {
+		t.Errorf("page with a bad record mismatch: %v %s", ids, cursor)
+	}
+	rqi.Cursor = cursor
+	ids, cursor = page(rqi)
+	if !reflect.DeepEqual(ids, []uint64{ms[3].ID, ms[4].ID, ms[5].ID}) || cursor == "" {
+		t.Errorf("page after a bad record mismatch: %v %s", ids, cursor)
+	}
+}
+
+func Test_iterate(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	kp := KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_Level_Score", Fields: []string{"Level", "Score"}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		return nil
+	})
+
+	ms := make([]member, 10)
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		for i := range ms {
+			ms[i].ID, _ = k.NextSequence(p)
+			ms[i].Email = fmt.Sprintf("%d@a.com", i)
+			ms[i].Level = 1 + i%2
+			ms[i].Score = float64(i)
+			k.Put(p, &ms[i])
+		}
+		return nil
+	})
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		cp := &countPoler{Poler: p}
+
+		//stop after the 3rd obj of Level 1
+		ids := make([]uint64, 0)
+		err := k.Iterate(cp, RangeInfo{
+			IndexName: "idx_Level_Score",
+			Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(1)}},
+		}, func(obj KVer) bool {
+			ids = append(ids, obj.(*member).ID)
+			return len(ids) < 3
+		})
+		if err != nil || !reflect.DeepEqual(ids, []uint64{ms[0].ID, ms[2].ID, ms[4].ID}) || cp.scanned != 3 {
+			t.Errorf("iterate fail: %v %v %d", err, ids, cp.scanned)
+		}
+
+		cp.scanned = 0
+		n := 0
+		err = k.IterateGets(cp, nil, func(obj KVer) bool {
+			n++
+			return n < 4
+		})
+		if err != nil || n != 4 || cp.scanned != 4 {
+			t.Errorf("iterate gets fail: %v %d %d", err, n, cp.scanned)
+		}
+
+		return nil
+	})
+}
+
+func Test_queryRangeBound(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	kp := KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_Level"},
+			{Name: "idx_Name"},
+			{Name: "idx_LevelNameDesc", Fields: []string{"Level", "Name"}, Desc: []string{"Name"}},
+			{Name: "idx_ScoreDesc", Fields: []string{"Score"}, Desc: []string{"Score"}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		return nil
+	})
+
+	//values with the key joiner/escaper, and the prefix of each other
+	names := []string{"", "a", "a!", "a:", "a:b", "a;", "a`", "a`b", "ab", "b", ":", "`", "A", "a\x00"}
+	levels := []int{-100, -1, 0, 1, 3, 5, 7, 58, 59, 96, 97, 0x3a3a, 1 << 40}
+	ms := make([]member, 0)
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		for i := range levels {
+			for j := range names {
+				if (i+j)%3 != 0 {
+					continue
+				}
+				m := member{Name: names[j], Level: levels[i], Score: float64(levels[i]) / 2}
+				m.ID, _ = k.NextSequence(p)
+				m.Email = fmt.Sprintf("%d@a.com", m.ID)
+				if err := k.Put(p, &m); err != nil {
+					t.Errorf("put kvt fail: %s", err)
+				}
+				ms = append(ms, m)
+			}
+		}
+		return nil
+	})
+
+	ops := map[string]func(c int) bool{
+		">":  func(c int) bool { return c > 0 },
+		">=": func(c int) bool { return c >= 0 },
+		"<":  func(c int) bool { return c < 0 },
+		"<=": func(c int) bool { return c <= 0 },
+	}
+
+	check := func(rangeInfo RangeInfo, match func(m member) bool) {
+		want := make(map[uint64]bool)
+		for i := range ms {
+			if match(ms[i]) {
+				want[ms[i].ID] = true
+			}
+		}
+		bdb.View(func(tx *bolt.Tx) error {
+			p, _ := NewPoler(tx)
+			r, err := k.RangeQuery(p, rangeInfo)
+			if err != nil || len(r) != len(want) {
+				t.Errorf("range bound query fail %v %v: %d %d", rangeInfo.IndexName, rangeInfo.Where, len(r), len(want))
+				return nil
+			}
+			for i := range r {
+				if !want[r[i].(*member).ID] {
+					t.Errorf("range bound query got unexpected %v", r[i])
+				}
+			}
+			return nil
+		})
+	}
+
+	for op, cmp := range ops {
+		for _, name := range names {
+			check(RangeInfo{
+				IndexName: "idx_Name",
+				Where:     map[string]map[string][]byte{"Name": {op: EncodeString(name)}},
+			}, func(m member) bool { return cmp(strings.Compare(m.Name, name)) })
+
+			check(RangeInfo{
+				IndexName: "idx_LevelNameDesc",
+				Where: map[string]map[string][]byte{
+					"Level": {"=": EncodeInt64(58)},
+					"Name":  {op: EncodeString(name)},
+				},
+			}, func(m member) bool { return m.Level == 58 && cmp(strings.Compare(m.Name, name)) })
+		}
+		for _, level := range levels {
+			check(RangeInfo{
+				IndexName: "idx_Level",
+				Where:     map[string]map[string][]byte{"Level": {op: EncodeInt64(int64(level))}},
+			}, func(m member) bool { return cmp(m.Level - level) })
+
+			score := float64(level) / 2
+			check(RangeInfo{
+				IndexName: "idx_ScoreDesc",
+				Where:     map[string]map[string][]byte{"Score": {op: EncodeFloat64(score)}},
+			}, func(m member) bool {
+				switch {
+				case m.Score < score:
+					return cmp(-1)
+				case m.Score > score:
+					return cmp(1)
+				}
+				return cmp(0)
+			})
+		}
+	}
+
+	//3 <= Level < 7 should seek to 3 and stop at 7
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		cp := &countPoler{Poler: p}
+		r, err := k.RangeQuery(cp, RangeInfo{
+			IndexName: "idx_Level",
+			Where:     map[string]map[string][]byte{"Level": {">=": EncodeInt64(3), "<": EncodeInt64(7)}},
+		})
+		n := 0
+		for i := range ms {
+			if ms[i].Level >= 3 && ms[i].Level <= 7 {
+				n++
+			}
+		}
+		if err != nil || len(r) == 0 || cp.scanned != n {
+			t.Errorf("range bound scan too much: %v %d %d %d", err, len(r), cp.scanned, n)
+		}
+		return nil
+	})
+}
+
+func Test_count(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	decoded := 0
+	kp := KVTParam{
+		Bucket: "Bucket_Member",
+		Unmarshal: func(b []byte, obj KVer) (KVer, error) {
+			decoded++
+			return memberUnmarshal(b, obj)
+		},
+		Indexs: []IndexInfo{
+			{Name: "idx_Level_Score", Fields: []string{"Level", "Score"}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		for i := 0; i < 10; i++ {
+			m := member{Email: fmt.Sprintf("%d@a.com", i), Level: 1 + i%2, Score: float64(i)}
+			if i < 4 {
+				m.Tags = []string{"x", "y"}
+			}
+			m.ID, _ = k.NextSequence(p)
+			if err := k.Put(p, &m); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		return nil
+	})
+
+	decoded = 0
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+
+		cmpCount := func(n int, err error, expect int) {
+			if err != nil || n != expect {
+				t.Errorf("count fail %v %d %d", err, n, expect)
+			}
+		}
+
+		n, err := k.CountAll(p)
+		cmpCount(n, err, 10)
+
+		n, err = k.Count(p, RangeInfo{IndexName: "idx_Level_Score"})
+		cmpCount(n, err, 10)
+
+		//Level 2 has Score 1, 3, 5, 7, 9
+		n, err = k.Count(p, RangeInfo{
+			IndexName: "idx_Level_Score",
+			Where: map[string]map[string][]byte{
+				"Level": {"=": EncodeInt64(2)},
+				"Score": {">=": EncodeFloat64(5)},
+			},
+		})
+		cmpCount(n, err, 3)
+
+		n, err = k.Count(p, RangeInfo{
+			IndexName: "idx_Level_Score",
+			Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(2)}},
+			Offset:    1,
+			Limit:     3,
+		})
+		cmpCount(n, err, 3)
+
+		n, err = k.CountQuery(p, QueryInfo{
+			IndexName: "idx_Level_Name",
+			Where:     map[string][]byte{"Level": EncodeInt64(1)},
+		})
+		cmpCount(n, err, 5)
+
+		n, err = k.CountQuery(p, QueryInfo{
+			IndexName: "idx_Email",
+			Where:     map[string][]byte{"Email": EncodeString("3@a.com")},
+		})
+		cmpCount(n, err, 1)
+
+		//an obj hit by several mindex keys is counted once
+		n, err = k.Count(p, RangeInfo{IndexName: "midx_Tags"})
+		cmpCount(n, err, 4)
+		n, err = k.Count(p, RangeInfo{
+			IndexName: "midx_Tags",
+			Where:     map[string]map[string][]byte{"Tags": {"in": MakeValues(EncodeString("x"), EncodeString("y"))}},
+		})
+		cmpCount(n, err, 4)
+
+		_, err = k.Count(p, RangeInfo{IndexName: "idx_NotExist"})
+		if err == nil {
+			t.Errorf("count should fail with a wrong index")
+		}
+		return nil
+	})
+
+	if decoded != 0 {
+		t.Errorf("count should not decode any obj: %d", decoded)
+	}
+
+	//a write tx counts its own puts and deletes
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.DeleteDataBucket(p)
+		k.DeleteIndexBuckets(p)
+		k.CreateDataBucket(p)
+		k.CreateIndexBuckets(p)
+		ms := make([]member, 3)
+		for i := range ms {
+			ms[i] = member{ID: uint64(i + 1), Email: fmt.Sprintf("%d@w.com", i), Level: 1, Score: float64(i)}
+			if err := k.Put(p, &ms[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		if n, err := k.CountAll(p); err != nil || n != 3 {
+			t.Errorf("count all in write tx fail: %v %d", err, n)
+		}
+		if n, err := k.Count(p, RangeInfo{IndexName: "idx_Level_Score"}); err != nil || n != 3 {
+			t.Errorf("count index in write tx fail: %v %d", err, n)
+		}
+		return nil
+	})
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		if err := k.Put(p, &member{ID: 4, Email: "3@w.com", Level: 1, Score: 3}); err != nil {
+			t.Errorf("put kvt fail: %s", err)
+		}
+		for _, id := range []uint64{1, 2} {
+			if err := k.Delete(p, &member{ID: id}); err != nil {
+				t.Errorf("delete kvt fail: %s", err)
+			}
+		}
+		if n, err := k.CountAll(p); err != nil || n != 2 {
+			t.Errorf("count all in write tx fail: %v %d", err, n)
+		}
+		if n, err := k.Count(p, RangeInfo{IndexName: "idx_Level_Score"}); err != nil || n != 2 {
+			t.Errorf("count index in write tx fail: %v %d", err, n)
+		}
+		return nil
+	})
+}
+
+func Test_queryKeysRaw(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	decoded := 0
+	kp := KVTParam{
+		Bucket: "Bucket_Member",
+		Unmarshal: func(b []byte, obj KVer) (KVer, error) {
+			decoded++
+			return memberUnmarshal(b, obj)
+		},
+		Indexs: []IndexInfo{
+			{Name: "idx_Level_Score", Fields: []string{"Level", "Score"}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	ms := make([]member, 10)
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		for i := range ms {
+			ms[i].ID, _ = k.NextSequence(p)
+			ms[i].Email = fmt.Sprintf("%d@a.com", i)
+			ms[i].Level = 1 + i%2
+			ms[i].Score = float64(i)
+			if err := k.Put(p, &ms[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		return nil
+	})
+
+	decoded = 0
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+
+		//Level 2 has Score 1, 3, 5, 7, 9
+		ri := RangeInfo{
+			IndexName: "idx_Level_Score",
+			Where: map[string]map[string][]byte{
+				"Level": {"=": EncodeInt64(2)},
+				"Score": {">=": EncodeFloat64(5)},
+			},
+		}
+		expect := []member{ms[5], ms[7], ms[9]}
+
+		pks, err := k.RangeQueryKeys(p, ri)
+		if err != nil || len(pks) != len(expect) {
+			t.Errorf("range query keys fail %v %d", err, len(pks))
+		} else {
+			for i := range pks {
+				if !bytes.Equal(pks[i], EncodeUint64(expect[i].ID)) {
+					t.Errorf("pk mismatch at %d", i)
+				}
+			}
+		}
+
+		raws, err := k.RangeQueryRaw(p, ri)
+		if err != nil || len(raws) != len(expect) {
+			t.Errorf("range query raw fail %v %d", err, len(raws))
+		} else {
+			for i := range raws {
+				v, _ := expect[i].Value()
+				if !bytes.Equal(raws[i].Key, EncodeUint64(expect[i].ID)) || !bytes.Equal(raws[i].Value, v) {
+					t.Errorf("raw mismatch at %d", i)
+				}
+			}
+		}
+
+		qi := QueryInfo{
+			IndexName: "idx_Level_Name",
+			Where:     map[string][]byte{"Level": EncodeInt64(1)},
+		}
+		pks, err = k.QueryKeys(p, qi)
+		if err != nil || len(pks) != 5 {
+			t.Errorf("query keys fail %v %d", err, len(pks))
+		}
+		raws, err = k.QueryRaw(p, qi)
+		if err != nil || len(raws) != 5 {
+			t.Errorf("query raw fail %v %d", err, len(raws))
+		}
+
+		raws, err = k.GetsRaw(p, nil)
+		if err != nil || len(raws) != len(ms) {
+			t.Errorf("gets raw fail %v %d", err, len(raws))
+		}
+
+		_, err = k.RangeQueryKeys(p, RangeInfo{IndexName: "idx_NotExist"})
+		if err == nil {
+			t.Errorf("query keys should fail with a wrong index")
+		}
+		return nil
+	})
+
+	if decoded != 0 {
+		t.Errorf("keys/raw query should not decode any obj: %d", decoded)
+	}
+}
+
+func Test_coverIndex(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	_, err = New(member{}, &KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Indexs:    []IndexInfo{{Name: "idx_Level", Cover: []string{"NotExist"}}},
+	})
+	if err == nil {
+		t.Errorf("new kvt should fail with a wrong cover field")
+	}
+
+	decoded := 0
+	kp := KVTParam{
+		Bucket: "Bucket_Member",
+		Unmarshal: func(b []byte, obj KVer) (KVer, error) {
+			decoded++
+			return memberUnmarshal(b, obj)
+		},
+		Indexs: []IndexInfo{
+			{Name: "idx_Level_Score", Fields: []string{"Level", "Score"}, Cover: []string{"Name", "Email"}},
+		},
+		MIndexs: []MIndex{
+			{IndexInfo: &IndexInfo{
+				Name:   "midx_TagsName",
+				Fields: []string{"Tags"},
+				Project: func(obj any) ([]byte, error) {
+					return []byte(obj.(*member).Name), nil
+				},
+			}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	ms := make([]member, 6)
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		for i := range ms {
+			ms[i].ID, _ = k.NextSequence(p)
+			ms[i].Email = fmt.Sprintf("%d@a.com", i)
+			ms[i].Name = fmt.Sprintf("name:%d", i)
+			ms[i].Level = 1 + i%2
+			ms[i].Score = float64(i)
+			ms[i].Tags = []string{"a"}
+			if err := k.Put(p, &ms[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		//index key unchanged, the projection should be refreshed
+		ms[3].Name = "renamed"
+		if err := k.Put(p, &ms[3]); err != nil {
+			t.Errorf("update kvt fail: %s", err)
+		}
+		return nil
+	})
+
+	decoded = 0
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+
+		//Level 2 has Score 1, 3, 5
+		ri := RangeInfo{
+			IndexName: "idx_Level_Score",
+			Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(2)}},
+		}
+		expect := []member{ms[1], ms[3], ms[5]}
+		r, err := k.RangeQueryCover(p, ri)
+		if err != nil || len(r) != len(expect) {
+			t.Errorf("range query cover fail %v %d", err, len(r))
+		} else {
+			for i := range r {
+				fields, err := k.CoverFields("idx_Level_Score", r[i].Value)
+				if err != nil {
+					t.Errorf("cover fields fail: %s", err)
+					continue
+				}
+				name, _ := DecodeString(fields["Name"])
+				email, _ := DecodeString(fields["Email"])
+				if !bytes.Equal(r[i].Key, EncodeUint64(expect[i].ID)) || name != expect[i].Name || email != expect[i].Email {
+					t.Errorf("projection mismatch at %d: %s %s", i, name, email)
+				}
+			}
+		}
+
+		r, err = k.QueryCover(p, QueryInfo{
+			IndexName: "midx_TagsName",
+			Where:     map[string][]byte{"Tags": EncodeString("a")},
+		})
+		if err != nil || len(r) != len(ms) {
+			t.Errorf("query mindex cover fail %v %d", err, len(r))
+		} else if string(r[3].Value) != "renamed" {
+			t.Errorf("mindex projection mismatch: %s", r[3].Value)
+		}
+		if decoded != 0 {
+			t.Errorf("cover query should not decode any obj: %d", decoded)
+		}
+
+		//normal query on the covering index still works
+		objs, err := k.RangeQuery(p, ri)
+		if err != nil || len(objs) != len(expect) || objs[1].(*member).Name != "renamed" {
+			t.Errorf("range query covering index fail %v %d", err, len(objs))
+		}
+
+		_, err = k.QueryCover(p, QueryInfo{
+			IndexName: "idx_Email",
+			Where:     map[string][]byte{"Email": EncodeString("1@a.com")},
+		})
+		if err == nil {
+			t.Errorf("cover query should fail with a plain index")
+		}
+		_, err = k.CoverFields("midx_TagsName", r[0].Value)
+		if err == nil {
+			t.Errorf("cover fields should fail with a projection func")
+		}
+
+		report, err := k.Verify(p)
+		if err != nil || !report.OK() {
+			t.Errorf("verify covering index fail %v %v", err, report)
+		}
+		return nil
+	})
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		if err := k.RebuildIndexes(p); err != nil {
+			t.Errorf("rebuild fail: %s", err)
+		}
+		report, err := k.Verify(p)
+		if err != nil || !report.OK() {
+			t.Errorf("verify rebuilt covering index fail %v %v", err, report)
+		}
+		return nil
+	})
+}
+
+func Test_partialIndex(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	active := func(obj any) bool {
+		return obj.(*member).Level == 2
+	}
+	kp := KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_ScoreActive", Fields: []string{"Score"}, Partial: active},
+			{Name: "idx_NameActive", Fields: []string{"Name"}, Unique: true, Partial: active},
+		},
+		MIndexs: []MIndex{
+			{IndexInfo: &IndexInfo{Name: "midx_TagsActive", Fields: []string{"Tags"}, Partial: active}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	//Level 2 is active: ms[1], ms[3], ms[5]
+	ms := make([]member, 6)
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		for i := range ms {
+			ms[i].ID, _ = k.NextSequence(p)
+			ms[i].Email = fmt.Sprintf("%d@a.com", i)
+			ms[i].Name = fmt.Sprintf("name%d", i%2) //inactive ones share the name
+			ms[i].Level = 1 + i%2
+			ms[i].Score = float64(i)
+			ms[i].Tags = []string{"a"}
+			if i%2 == 1 {
+				ms[i].Name = fmt.Sprintf("name%d", i)
+			}
+			if err := k.Put(p, &ms[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		return nil
+	})
+
+	scoreInfo := RangeInfo{
+		IndexName: "idx_ScoreActive",
+		Where:     map[string]map[string][]byte{"Score": {">=": EncodeFloat64(0)}},
+	}
+	tagInfo := QueryInfo{
+		IndexName: "midx_TagsActive",
+		Where:     map[string][]byte{"Tags": EncodeString("a")},
+		Partial:   true,
+	}
+	cmpIDs := func(p Poler, ids ...uint64) {
+		partial := scoreInfo
+		partial.Partial = true
+		r, err := k.RangeQuery(p, partial)
+		if err != nil || len(r) != len(ids) {
+			t.Errorf("query partial index fail %v %d %d", err, len(r), len(ids))
+			return
+		}
+		for i := range r {
+			if r[i].(*member).ID != ids[i] {
+				t.Errorf("partial index result mismatch at %d: %d %d", i, r[i].(*member).ID, ids[i])
+			}
+		}
+		if n, err := k.CountQuery(p, tagInfo); err != nil || n != len(ids) {
+			t.Errorf("count partial mindex fail %v %d %d", err, n, len(ids))
+		}
+	}
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		cmpIDs(p, ms[1].ID, ms[3].ID, ms[5].ID)
+
+		if _, err := k.RangeQuery(p, scoreInfo); err == nil {
+			t.Errorf("query partial index should fail without Partial")
+		}
+		if _, err := k.Count(p, scoreInfo); err == nil {
+			t.Errorf("count partial index should fail without Partial")
+		}
+		uniqueInfo := QueryInfo{IndexName: "idx_NameActive", Where: map[string][]byte{"Name": EncodeString("name3")}}
+		if _, err := k.GetUnique(p, uniqueInfo, nil); err == nil {
+			t.Errorf("get unique on partial index should fail without Partial")
+		}
+		uniqueInfo.Partial = true
+		if obj, err := k.GetUnique(p, uniqueInfo, nil); err != nil || obj.(*member).ID != ms[3].ID {
+			t.Errorf("get unique on partial index fail: %v", err)
+		}
+
+		//leave the partial index
+		ms[1].Level = 1
+		if err := k.Put(p, &ms[1]); err != nil {
+			t.Errorf("update kvt fail: %s", err)
+		}
+		cmpIDs(p, ms[3].ID, ms[5].ID)
+
+		//join the partial index, name0 is shared by the inactive ones
+		ms[0].Level = 2
+		if err := k.Put(p, &ms[0]); err != nil {
+			t.Errorf("update kvt fail: %s", err)
+		}
+		cmpIDs(p, ms[0].ID, ms[3].ID, ms[5].ID)
+
+		ms[2].Level = 2
+		var ue *UniqueError
+		if err := k.Put(p, &ms[2]); !errors.As(err, &ue) || ue.Index != "idx_NameActive" {
+			t.Errorf("partial unique index should reject the duplicate: %v", err)
+		}
+		ms[2].Level = 1
+
+		k.Delete(p, &ms[3])
+		cmpIDs(p, ms[0].ID, ms[5].ID)
+
+		report, err := k.Verify(p)
+		if err != nil || !report.OK() {
+			t.Errorf("verify partial index fail %v %v", err, report)
+		}
+		if err := k.RebuildIndexes(p); err != nil {
+			t.Errorf("rebuild fail: %s", err)
+		}
+		cmpIDs(p, ms[0].ID, ms[5].ID)
+		return nil
+	})
+
+	//the Index() of a partial index is never called for the obj outside it, it fails without a Code
+	coded, err := New(tagged{}, &KVTParam{
+		Bucket: "Bucket_Coded",
+		Indexs: []IndexInfo{
+			{Name: "idx_Code", Fields: []string{"Code"}, Partial: func(obj any) bool { return obj.(*tagged).Code != "" }},
+		},
+	})
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		coded.CreateDataBucket(p)
+		coded.CreateIndexBuckets(p)
+		codeInfo := QueryInfo{IndexName: "idx_Code", Where: map[string][]byte{"Code": EncodeString("code-c")}, Partial: true}
+
+		obj := tagged{ID: 1, Name: "ann"}
+		if err := coded.Put(p, &obj); err != nil {
+			t.Errorf("insert outside the partial index fail: %s", err)
+		}
+		obj.Name = "bob"
+		if err := coded.Put(p, &obj); err != nil {
+			t.Errorf("update outside the partial index fail: %s", err)
+		}
+		obj.Code = "c" //join
+		if err := coded.Put(p, &obj); err != nil {
+			t.Errorf("update into the partial index fail: %s", err)
+		}
+		if r, err := coded.Query(p, codeInfo); err != nil || len(r) != 1 {
+			t.Errorf("query partial index fail: %v %v", r, err)
+		}
+		obj.Code = "" //leave
+		if err := coded.Put(p, &obj); err != nil {
+			t.Errorf("update out of the partial index fail: %s", err)
+		}
+		if r, err := coded.Query(p, codeInfo); err != nil || len(r) != 0 {
+			t.Errorf("query partial index fail: %v %v", r, err)
+		}
+		if err := coded.Delete(p, &obj); err != nil {
+			t.Errorf("delete outside the partial index fail: %s", err)
+		}
+		return nil
+	})
+}
+
+func Test_find(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	kp := KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_Level_Score", Fields: []string{"Level", "Score"}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	ms := make([]member, 12)
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		for i := range ms {
+			ms[i].ID, _ = k.NextSequence(p)
+			ms[i].Email = fmt.Sprintf("%d@a.com", i)
+			ms[i].Name = fmt.Sprintf("name%d", i%3)
+			ms[i].Level = 1 + i%2
+			ms[i].Score = float64(i)
+			ms[i].Tags = []string{"a", fmt.Sprintf("t%d", i%4)}
+			if err := k.Put(p, &ms[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		return nil
+	})
+
+	cases := []struct {
+		where map[string]map[string][]byte
+		plan  string
+		match func(m member) bool
+	}{
+		{
+			map[string]map[string][]byte{"Level": {"=": EncodeInt64(2)}, "Score": {">=": EncodeFloat64(5)}},
+			"index idx_Level_Score, prefix [Level], range [Score], filter []",
+			func(m member) bool { return m.Level == 2 && m.Score >= 5 },
+		},
+		{
+			map[string]map[string][]byte{"Level": {"=": EncodeInt64(1)}, "Name": {"=": EncodeString("name2")}},
+			"index idx_Level_Name, prefix [Level Name], range [], filter []",
+			func(m member) bool { return m.Level == 1 && m.Name == "name2" },
+		},
+		{
+			map[string]map[string][]byte{"Email": {"=": EncodeString("3@a.com")}, "Score": {"<": EncodeFloat64(5)}},
+			"index idx_Email, prefix [Email], range [], filter [Score]",
+			func(m member) bool { return m.Email == "3@a.com" && m.Score < 5 },
+		},
+		{
+			map[string]map[string][]byte{"Tags": {"=": EncodeString("t1")}, "Level": {"=": EncodeInt64(2)}},
+			"index midx_Tags, prefix [Tags], range [], filter [Level]",
+			func(m member) bool { return m.Level == 2 && m.Tags[1] == "t1" },
+		},
+		{
+			map[string]map[string][]byte{"Tags": {">=": EncodeString("a")}, "Score": {"<": EncodeFloat64(3)}},
+			"index idx_Score, prefix [], range [Score], filter [Tags]",
+			func(m member) bool { return m.Score < 3 },
+		},
+		{
+			map[string]map[string][]byte{"Name": {"=": EncodeString("name1")}, "Tags": {"=": EncodeString("t3")}},
+			"index midx_Tags, prefix [Tags], range [], filter [Name]",
+			func(m member) bool { return m.Name == "name1" && m.Tags[1] == "t3" },
+		},
+		{
+			map[string]map[string][]byte{"Name": {"=": EncodeString("name1")}},
+			"full scan, filter [Name]",
+			func(m member) bool { return m.Name == "name1" },
+		},
+		{
+			nil,
+			"full scan, filter []",
+			func(m member) bool { return true },
+		},
+	}
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		for i, c := range cases {
+			r, plan, err := k.Find(p, c.where)
+			if err != nil {
+				t.Errorf("find %d fail: %s", i, err)
+				continue
+			}
+			if plan.String() != c.plan {
+				t.Errorf("find %d plan mismatch: %s", i, plan)
+			}
+			expect := make(map[uint64]struct{})
+			for _, m := range ms {
+				if c.match(m) {
+					expect[m.ID] = struct{}{}
+				}
+			}
+			if len(r) != len(expect) {
+				t.Errorf("find %d got %d objs, expect %d", i, len(r), len(expect))
+				continue
+			}
+			for _, obj := range r {
+				if _, ok := expect[obj.(*member).ID]; !ok {
+					t.Errorf("find %d got unexpected obj %d", i, obj.(*member).ID)
+				}
+			}
+		}
+
+		_, _, err := k.Find(p, map[string]map[string][]byte{"Level": {"~": EncodeInt64(1)}})
+		if err == nil {
+			t.Errorf("find should fail with a wrong operator")
+		}
+		_, _, err = k.Find(p, map[string]map[string][]byte{"NotExist": {"=": EncodeInt64(1)}})
+		if err == nil {
+			t.Errorf("find should fail with a wrong field")
+		}
+		return nil
+	})
+}
+
+func Test_explain(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	kp := KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_Level_Score", Fields: []string{"Level", "Score"}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		for i := 0; i < 10; i++ {
+			m := member{Email: fmt.Sprintf("%d@a.com", i), Level: 1 + i%2, Score: float64(i)}
+			m.ID, _ = k.NextSequence(p)
+			if err := k.Put(p, &m); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		return nil
+	})
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+
+		//Level 2 has Score 1, 3, 5, 7, 9, the bound starts the scan at Score 5
+		e, err := k.Explain(RangeInfo{
+			IndexName: "idx_Level_Score",
+			Where: map[string]map[string][]byte{
+				"Level": {"=": EncodeInt64(2)},
+				"Score": {">=": EncodeFloat64(5)},
+			},
+		})
+		if err != nil {
+			t.Errorf("explain fail: %s", err)
+			return nil
+		}
+		if !reflect.DeepEqual(e.PrefixFields, []string{"Level"}) || !reflect.DeepEqual(e.FilterFields, []string{"Score"}) ||
+			!reflect.DeepEqual(e.Prefix, [][]byte{EncodeInt64(2)}) || !e.Bounded {
+			t.Errorf("explain plan mismatch: %s", e)
+		}
+		r, err := e.Run(p)
+		if err != nil || len(r) != 3 {
+			t.Errorf("explain run fail %v %d", err, len(r))
+		}
+		if e.Stats != (QueryStats{Scanned: 3, Filtered: 0, Fetched: 3}) {
+			t.Errorf("explain stats mismatch: %s", e)
+		}
+
+		//no prefix, all keys are scanned and filtered by Score
+		e, err = k.Explain(RangeInfo{
+			IndexName: "idx_Level_Score",
+			Where:     map[string]map[string][]byte{"Score": {">=": EncodeFloat64(5)}},
+		})
+		if err != nil {
+			t.Errorf("explain fail: %s", err)
+			return nil
+		}
+		if len(e.PrefixFields) != 0 || len(e.Prefix) != 0 || !reflect.DeepEqual(e.FilterFields, []string{"Score"}) || e.Bounded {
+			t.Errorf("explain plan mismatch: %s", e)
+		}
+		r, err = e.Run(p)
+		if err != nil || len(r) != 5 {
+			t.Errorf("explain run fail %v %d", err, len(r))
+		}
+		if e.Stats != (QueryStats{Scanned: 10, Filtered: 5, Fetched: 5}) {
+			t.Errorf("explain stats mismatch: %s", e)
+		}
+
+		//stats of a query directly
+		stats := &QueryStats{}
+		k.Iterate(p, RangeInfo{
+			IndexName: "idx_Level_Score",
+			Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(1)}},
+			Stats:     stats,
+		}, func(obj KVer) bool { return true })
+		if *stats != (QueryStats{Scanned: 5, Filtered: 0, Fetched: 5}) {
+			t.Errorf("iterate stats mismatch: %v", *stats)
+		}
+
+		if _, err := k.Explain(RangeInfo{IndexName: "idx_NotExist"}); err == nil {
+			t.Errorf("explain should fail with a wrong index")
+		}
+		return nil
+	})
+}
+
+func Test_queryOperators(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	kp := KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_Level_Score", Fields: []string{"Level", "Score"}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	//names in key order, the escaped chars should not break the prefix match
+	names := []string{"Ak", "Al", "Al:x", "Al`", "Ala", "Alb", "Am"}
+	ms := make([]member, 12)
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		for i := range ms {
+			ms[i].ID, _ = k.NextSequence(p)
+			ms[i].Email = fmt.Sprintf("%d@a.com", i)
+			ms[i].Name = names[i%len(names)]
+			ms[i].Level = 1 + i%3
+			ms[i].Score = float64(i)
+			if err := k.Put(p, &ms[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		return nil
+	})
+
+	//expected objs in (Level, Score) order
+	byScore := func(match func(m member) bool) (ids []uint64) {
+		for level := 1; level <= 3; level++ {
+			for _, m := range ms {
+				if m.Level == level && match(m) {
+					ids = append(ids, m.ID)
+				}
+			}
+		}
+		return ids
+	}
+	cmpIDs := func(name string, r []any, err error, ids []uint64) {
+		if err != nil || len(r) != len(ids) {
+			t.Errorf("%s fail %v %d %d", name, err, len(r), len(ids))
+			return
+		}
+		for i := range r {
+			if r[i].(*member).ID != ids[i] {
+				t.Errorf("%s order mismatch at %d: %d %d", name, i, r[i].(*member).ID, ids[i])
+			}
+		}
+	}
+	score := func(where map[string]map[string][]byte) RangeInfo {
+		return RangeInfo{IndexName: "idx_Level_Score", Where: where}
+	}
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+
+		in := map[string]map[string][]byte{"Level": {"IN": MakeValues(EncodeInt64(3), EncodeInt64(1))}}
+		r, err := k.RangeQuery(p, score(in))
+		expect := byScore(func(m member) bool { return m.Level != 2 })
+		cmpIDs("in", r, err, expect)
+
+		e, _ := k.Explain(score(in))
+		if e.Scans != 2 || !reflect.DeepEqual(e.PrefixFields, []string{"Level"}) || len(e.FilterFields) != 0 {
+			t.Errorf("in should be prefix scans: %s", e)
+		}
+
+		ri := score(in)
+		ri.Reverse = true
+		r, err = k.RangeQuery(p, ri)
+		reversed := make([]uint64, len(expect))
+		for i := range expect {
+			reversed[len(expect)-1-i] = expect[i]
+		}
+		cmpIDs("in reverse", r, err, reversed)
+
+		//page through the scans
+		ri = score(in)
+		ri.Limit = 3
+		var paged []any
+		for {
+			r, cursor, err := k.RangeQueryPage(p, ri)
+			if err != nil {
+				t.Errorf("in page fail: %s", err)
+				break
+			}
+			paged = append(paged, r...)
+			if cursor == "" {
+				break
+			}
+			ri.Cursor = cursor
+		}
+		cmpIDs("in page", paged, nil, expect)
+
+		r, err = k.RangeQuery(p, score(map[string]map[string][]byte{
+			"Level": {"in": MakeValues(EncodeInt64(1), EncodeInt64(3))},
+			"Score": {"between": MakeValues(EncodeFloat64(2), EncodeFloat64(9))},
+		}))
+		cmpIDs("in between", r, err, byScore(func(m member) bool { return m.Level != 2 && m.Score >= 2 && m.Score <= 9 }))
+
+		r, err = k.RangeQuery(p, score(map[string]map[string][]byte{
+			"Level": {"!=": EncodeInt64(2)},
+			"Score": {"not in": MakeValues(EncodeFloat64(0), EncodeFloat64(5), EncodeFloat64(6))},
+		}))
+		cmpIDs("not equal, not in", r, err, byScore(func(m member) bool { return m.Level != 2 && m.Score != 0 && m.Score != 5 && m.Score != 6 }))
+
+		r, err = k.RangeQuery(p, score(map[string]map[string][]byte{"Level": {"NOT  IN": MakeValues(EncodeInt64(1))}}))
+		cmpIDs("not in", r, err, byScore(func(m member) bool { return m.Level != 1 }))
+
+		r, err = k.RangeQuery(p, score(map[string]map[string][]byte{"Level": {"in": MakeValues()}}))
+		cmpIDs("in nothing", r, err, nil)
+
+		//prefix on the second field, the bound narrows the scan
+		for level := 1; level <= 3; level++ {
+			cp := &countPoler{Poler: p}
+			r, err = k.RangeQuery(cp, RangeInfo{
+				IndexName: "idx_Level_Name",
+				Where: map[string]map[string][]byte{
+					"Level": {"=": EncodeInt64(int64(level))},
+					"Name":  {"prefix": EncodeString("Al")},
+				},
+			})
+			var ids []uint64
+			for _, name := range names {
+				for _, m := range ms {
+					if m.Level == level && m.Name == name && strings.HasPrefix(name, "Al") {
+						ids = append(ids, m.ID)
+					}
+				}
+			}
+			cmpIDs("prefix", r, err, ids)
+			if cp.scanned > len(ids)+1 {
+				t.Errorf("prefix should bound the scan: %d %d", cp.scanned, len(ids))
+			}
+		}
+
+		res, plan, err := k.Find(p, map[string]map[string][]byte{
+			"Level": {"in": MakeValues(EncodeInt64(2), EncodeInt64(3))},
+			"Name":  {"prefix": EncodeString("Al")},
+		})
+		if err != nil || plan.IndexName != "idx_Level_Name" || !reflect.DeepEqual(plan.Equals, []string{"Level"}) ||
+			len(res) != len(byScore(func(m member) bool { return m.Level != 1 && strings.HasPrefix(m.Name, "Al") })) {
+			t.Errorf("find with in fail %v %s %d", err, plan, len(res))
+		}
+
+		_, err = k.RangeQuery(p, score(map[string]map[string][]byte{"Level": {"like": EncodeInt64(1)}}))
+		if err == nil {
+			t.Errorf("query should fail with a wrong operator")
+		}
+		return nil
+	})
+}
+
+func Test_collate(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	_, err = New(member{}, &KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Operators: map[string]CompareFunc{"=": bytes.Equal},
+	})
+	if err == nil {
+		t.Errorf("new kvt should fail when replace a builtin operator")
+	}
+	_, err = New(member{}, &KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Fields:    map[string]FieldInfo{"NotExist": {Collate: CollateFold}},
+	})
+	if err == nil {
+		t.Errorf("new kvt should fail with a wrong field")
+	}
+
+	kp := KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Operators: map[string]CompareFunc{"contains": bytes.Contains},
+		Fields: map[string]FieldInfo{
+			"Name":  {Collate: CollateFold, Operators: map[string]CompareFunc{"len>": func(d, v []byte) bool { return len(d) > len(v) }}},
+			"Email": {Collate: CollateFold},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	//case insensitive key order
+	names := []string{"alice", "ALICEX", "Bob", "carol"}
+	ms := make([]member, len(names))
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		for i := len(ms) - 1; i >= 0; i-- {
+			ms[i].ID, _ = k.NextSequence(p)
+			ms[i].Email = fmt.Sprintf("%s@a.com", names[i])
+			ms[i].Name = names[i]
+			ms[i].Level = 1
+			if err := k.Put(p, &ms[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		m := member{ID: 1, Email: "BOB@A.COM"}
+		var ue *UniqueError
+		if err := k.Put(p, &m); !errors.As(err, &ue) || ue.Index != "idx_Email" {
+			t.Errorf("collated unique index should reject the duplicate: %v", err)
+		}
+		return nil
+	})
+
+	cmpNames := func(name string, r []any, err error, expect ...string) {
+		if err != nil || len(r) != len(expect) {
+			t.Errorf("%s fail %v %d %d", name, err, len(r), len(expect))
+			return
+		}
+		for i := range r {
+			if r[i].(*member).Name != expect[i] {
+				t.Errorf("%s mismatch at %d: %s %s", name, i, r[i].(*member).Name, expect[i])
+			}
+		}
+	}
+	byName := func(where map[string][]byte) RangeInfo {
+		ri := RangeInfo{IndexName: "idx_Level_Name", Where: map[string]map[string][]byte{"Level": {"=": EncodeInt64(1)}}}
+		if where != nil {
+			ri.Where["Name"] = where
+		}
+		return ri
+	}
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+
+		r, err := k.RangeQuery(p, byName(nil))
+		cmpNames("order", r, err, "alice", "ALICEX", "Bob", "carol")
+
+		r, err = k.RangeQuery(p, byName(map[string][]byte{"=": EncodeString("ALICE")}))
+		cmpNames("equal", r, err, "alice")
+
+		r, err = k.RangeQuery(p, byName(map[string][]byte{">=": EncodeString("B"), "<": EncodeString("CAROL")}))
+		cmpNames("range", r, err, "Bob")
+
+		r, err = k.RangeQuery(p, byName(map[string][]byte{"in": MakeValues(EncodeString("BOB"), EncodeString("Carol"))}))
+		cmpNames("in", r, err, "Bob", "carol")
+
+		r, err = k.RangeQuery(p, byName(map[string][]byte{"prefix": EncodeString("ALI")}))
+		cmpNames("prefix", r, err, "alice", "ALICEX")
+
+		r, err = k.RangeQuery(p, byName(map[string][]byte{"contains": EncodeString("lic")}))
+		cmpNames("kvt operator", r, err, "alice", "ALICEX")
+
+		r, err = k.RangeQuery(p, byName(map[string][]byte{"len>": EncodeString("abcd")}))
+		cmpNames("field operator", r, err, "alice", "ALICEX", "carol")
+
+		_, err = k.RangeQuery(p, RangeInfo{
+			IndexName: "idx_Level_Name",
+			Where:     map[string]map[string][]byte{"Level": {"len>": EncodeInt64(1)}},
+		})
+		if err == nil {
+			t.Errorf("field operator should not work on other fields")
+		}
+
+		obj, err := k.GetUnique(p, QueryInfo{IndexName: "idx_Email", Where: map[string][]byte{"Email": EncodeString("CAROL@A.COM")}}, nil)
+		if err != nil || obj.(*member).Name != "carol" {
+			t.Errorf("get unique with collation fail: %v", err)
+		}
+
+		//full scan compares the collated values too
+		res, plan, err := k.Find(p, map[string]map[string][]byte{"Name": {"=": EncodeString("BOB")}})
+		if !plan.FullScan() {
+			t.Errorf("find should be a full scan: %s", plan)
+		}
+		cmpNames("find", res, err, "Bob")
+		return nil
+	})
+}
+
+func Test_queryTree(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	decoded := 0
+	kp := KVTParam{
+		Bucket: "Bucket_Member",
+		Unmarshal: func(b []byte, obj KVer) (KVer, error) {
+			decoded++
+			return memberUnmarshal(b, obj)
+		},
+		Indexs: []IndexInfo{
+			{Name: "idx_Level_Score", Fields: []string{"Level", "Score"}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	ms := make([]member, 12)
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		for i := range ms {
+			ms[i].ID, _ = k.NextSequence(p)
+			ms[i].Email = fmt.Sprintf("%d@a.com", i)
+			ms[i].Level = 1 + i%3
+			ms[i].Score = float64(i)
+			ms[i].Tags = []string{fmt.Sprintf("t%d", i%4)}
+			if i%5 == 0 {
+				ms[i].Tags = append(ms[i].Tags, "sale", "new")
+			}
+			if err := k.Put(p, &ms[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		return nil
+	})
+
+	level := func(op string, v int64) QueryNode {
+		return Cond(RangeInfo{IndexName: "idx_Level_Score", Where: map[string]map[string][]byte{"Level": {op: EncodeInt64(v)}}})
+	}
+	score := func(op string, v float64) QueryNode {
+		return Cond(RangeInfo{IndexName: "idx_Score", Where: map[string]map[string][]byte{"Score": {op: EncodeFloat64(v)}}})
+	}
+	tag := func(v string) QueryNode {
+		return CondQuery(QueryInfo{IndexName: "midx_Tags", Where: map[string][]byte{"Tags": EncodeString(v)}})
+	}
+	sale := func(m member) bool { return len(m.Tags) > 1 }
+
+	cases := []struct {
+		name  string
+		node  QueryNode
+		match func(m member) bool
+	}{
+		{"or", Or(level("=", 2), tag("sale"), tag("new")), func(m member) bool { return m.Level == 2 || sale(m) }},
+		{"and", And(level("=", 1), score(">=", 4)), func(m member) bool { return m.Level == 1 && m.Score >= 4 }},
+		{"and not", And(level("=", 1), Not(tag("sale"))), func(m member) bool { return m.Level == 1 && !sale(m) }},
+		{"not", Not(level("=", 1)), func(m member) bool { return m.Level != 1 }},
+		{"or not", Or(level("=", 2), Not(score(">=", 6))), func(m member) bool { return m.Level == 2 || m.Score < 6 }},
+		{"and all not", And(Not(level("=", 1)), Not(level("=", 2))), func(m member) bool { return m.Level == 3 }},
+		{"not not", Not(Not(tag("sale"))), sale},
+		{"nested", Or(And(level("=", 3), score("<", 6)), CondQuery(QueryInfo{IndexName: "idx_Email", Where: map[string][]byte{"Email": EncodeString("7@a.com")}})),
+			func(m member) bool { return (m.Level == 3 && m.Score < 6) || m.Email == "7@a.com" }},
+		{"empty and", And(), func(m member) bool { return true }},
+		{"empty or", Or(), func(m member) bool { return false }},
+	}
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		for _, c := range cases {
+			decoded = 0
+			r, err := k.QueryTree(p, c.node)
+			var ids []uint64
+			for _, m := range ms {
+				if c.match(m) {
+					ids = append(ids, m.ID)
+				}
+			}
+			if err != nil || len(r) != len(ids) {
+				t.Errorf("%s fail %v %d %d", c.name, err, len(r), len(ids))
+				continue
+			}
+			for i := range r {
+				if r[i].(*member).ID != ids[i] {
+					t.Errorf("%s mismatch at %d: %d %d", c.name, i, r[i].(*member).ID, ids[i])
+				}
+			}
+			if decoded != len(ids) {
+				t.Errorf("%s should fetch every obj once: %d %d", c.name, decoded, len(ids))
+			}
+			pks, err := k.QueryTreeKeys(p, c.node)
+			if err != nil || len(pks) != len(ids) {
+				t.Errorf("%s keys fail %v %d %d", c.name, err, len(pks), len(ids))
+			}
+		}
+
+		_, err := k.QueryTree(p, Or(level("=", 1), Cond(RangeInfo{IndexName: "idx_NotExist"})))
+		if err == nil {
+			t.Errorf("query tree should fail with a wrong index")
+		}
+		return nil
+	})
+}
+
+func Test_table(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	if _, err := NewTable[KVer](&KVTParam{Bucket: "Bucket_Member"}, nil); err == nil {
+		t.Errorf("table of an interface type should fail")
+	}
+
+	kp := KVTParam{Bucket: "Bucket_Member"}
+	decode := func(b []byte, dst *member) (*member, error) {
+		_, err := memberUnmarshal(b, dst) //dst is allocated by the table
+		return dst, err
+	}
+	tb, err := NewTable[*member](&kp, decode)
+	if err != nil {
+		t.Errorf("new table fail: %s", err)
+		return
+	}
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		tb.KVT().CreateDataBucket(p)
+		tb.KVT().CreateIndexBuckets(p)
+		for i := range 6 {
+			m := &member{ID: uint64(i + 1), Email: fmt.Sprintf("%d@a.com", i), Name: fmt.Sprintf("n%d", i), Level: 1 + i%2, Score: float64(i)}
+			if err := tb.Put(p, m); err != nil {
+				t.Errorf("put table fail: %s", err)
+			}
+		}
+		return nil
+	})
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+
+		m, err := tb.Get(p, &member{ID: 3})
+		if err != nil || m.Name != "n2" {
+			t.Errorf("get table fail: %v %v", m, err)
+		}
+		m, err = tb.GetUnique(p, QueryInfo{IndexName: "idx_Email", Where: map[string][]byte{"Email": EncodeString("4@a.com")}})
+		if err != nil || m.ID != 5 {
+			t.Errorf("get unique table fail: %v %v", m, err)
+		}
+
+		ms, err := tb.Query(p, QueryInfo{IndexName: "idx_Level_Name", Where: map[string][]byte{"Level": EncodeInt64(2)}})
+		if err != nil || len(ms) != 3 || ms[0].Name != "n1" || ms[2].Name != "n5" {
+			t.Errorf("query table fail: %v %v", ms, err)
+		}
+
+		ms, err = tb.RangeQuery(p, RangeInfo{IndexName: "idx_Score", Where: map[string]map[string][]byte{"Score": {">=": EncodeFloat64(4)}}})
+		if err != nil || len(ms) != 2 || ms[0].ID != 5 || ms[1].ID != 6 {
+			t.Errorf("range query table fail: %v %v", ms, err)
+		}
+
+		var ids []uint64
+		err = tb.Iterate(p, RangeInfo{IndexName: "idx_Score", Reverse: true}, func(m *member) bool {
+			ids = append(ids, m.ID)
+			return len(ids) < 2
+		})
+		if err != nil || !reflect.DeepEqual(ids, []uint64{6, 5}) {
+			t.Errorf("iterate table fail: %v %v", ids, err)
+		}
+
+		all, err := tb.Gets(p, nil)
+		if err != nil || len(all) != 6 {
+			t.Errorf("gets table fail: %v %v", all, err)
+		}
+		return nil
+	})
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		if err := tb.Delete(p, &member{ID: 3}); err != nil {
+			t.Errorf("delete table fail: %s", err)
+		}
+		if _, err := tb.Get(p, &member{ID: 3}); err == nil {
+			t.Errorf("deleted obj should not be found")
+		}
+		return nil
+	})
+}
+
+func Test_codec(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	for _, codec := range []Codec{nil, JSONCodec{}, BinaryCodec{}} {
+		k, err := New(note{}, &KVTParam{Bucket: "Bucket_note", Codec: codec})
+		if err != nil {
+			t.Errorf("new kvt fail: %s", err)
+			return
+		}
+
+		at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		bdb.Update(func(tx *bolt.Tx) error {
+			p, _ := NewPoler(tx)
+			k.DeleteDataBucket(p)
+			k.DeleteIndexBuckets(p)
+			k.CreateDataBucket(p)
+			k.CreateIndexBuckets(p)
+			for i := range 4 {
+				n := &note{ID: uint64(i + 1), Title: fmt.Sprintf("t%d", i%2), At: at.Add(time.Duration(i) * time.Hour), Stars: map[string]int{"x": i}}
+				if err := k.Put(p, n); err != nil {
+					t.Errorf("%T put fail: %s", codec, err)
+				}
+			}
+			//update through the codec decoded old obj
+			if err := k.Put(p, &note{ID: 1, Title: "t1", At: at}); err != nil {
+				t.Errorf("%T update fail: %s", codec, err)
+			}
+			return nil
+		})
+
+		bdb.View(func(tx *bolt.Tx) error {
+			p, _ := NewPoler(tx)
+			r, err := k.Query(p, QueryInfo{IndexName: "idx_Title", Where: map[string][]byte{"Title": EncodeString("t1")}})
+			if err != nil || len(r) != 3 {
+				t.Errorf("%T query fail: %v %v", codec, r, err)
+				return nil
+			}
+			n := r[2].(*note)
+			if n.ID != 4 || !n.At.Equal(at.Add(3*time.Hour)) || n.Stars["x"] != 3 {
+				t.Errorf("%T decoded mismatch: %+v", codec, n)
+			}
+			return nil
+		})
+	}
+}
+
+func Test_compress(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	plain, _ := New(note{}, &KVTParam{Bucket: "Bucket_note"})
+	packed, err := New(note{}, &KVTParam{Bucket: "Bucket_note", Compression: &Compression{Compressor: FlateCompressor{}, MinSize: 64}})
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	long := strings.Repeat("long text ", 50)
+	//the stored bytes of the data bucket
+	stored := func(p Poler) (vs [][]byte) {
+		p.Scan(plain.path, ScanInfo{}, func(k, v []byte) bool {
+			vs = append(vs, bytes.Clone(v))
+			return true
+		})
+		return vs
+	}
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		plain.CreateDataBucket(p)
+		plain.CreateIndexBuckets(p)
+		packed.CreateDataBucket(p)
+		packed.CreateIndexBuckets(p)
+		//a legacy record stored before compression on
+		plain.Put(p, &note{ID: 1, Title: "a", Refs: []uint64{1}})
+		packed.Put(p, &note{ID: 2, Title: "a", Refs: []uint64{2}})
+		packed.Put(p, &note{ID: 3, Title: long})
+		//update the legacy record, the old one is decoded before its indexs are replaced
+		if err := packed.Put(p, &note{ID: 1, Title: "b", Refs: []uint64{1}}); err != nil {
+			t.Errorf("put kvt fail: %s", err)
+		}
+		plain.Put(p, &note{ID: 4, Title: "a"})
+		return nil
+	})
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		vs := stored(p)
+		if len(vs) != 4 || vs[2][0] != headerFlate || len(vs[2]) > len(long)/2 {
+			t.Errorf("long value should be compressed: %v", vs)
+		}
+
+		r, err := packed.Gets(p, nil)
+		if err != nil || len(r) != 4 || r[2].(*note).Title != long || r[3].(*note).Title != "a" {
+			t.Errorf("gets mixed records fail: %v %v", r, err)
+		}
+		r, err = packed.Query(p, QueryInfo{IndexName: "idx_Title", Where: map[string][]byte{"Title": EncodeString("a")}})
+		if err != nil || len(r) != 2 || r[0].(*note).ID != 2 || r[1].(*note).ID != 4 {
+			t.Errorf("query mixed records fail: %v %v", r, err)
+		}
+
+		raws, err := packed.RangeQueryRaw(p, RangeInfo{IndexName: "idx_Title", Where: map[string]map[string][]byte{"Title": {"=": EncodeString(long)}}})
+		if err != nil || len(raws) != 1 {
+			t.Errorf("raw query fail: %v", err)
+		} else if obj, err := packed.unmarshal(raws[0].Value, nil); err != nil || obj.(*note).ID != 3 {
+			t.Errorf("raw value should be decompressed: %v", err)
+		}
+		return nil
+	})
+
+	//compression off, the compressed records are still read
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		r, err := plain.Gets(p, nil)
+		if err != nil || len(r) != 4 || r[2].(*note).Title != long {
+			t.Errorf("gets compressed records with compression off fail: %v %v", r, err)
+		}
+		r, err = plain.Query(p, QueryInfo{IndexName: "idx_Title", Where: map[string][]byte{"Title": EncodeString(long)}})
+		if err != nil || len(r) != 1 || r[0].(*note).ID != 3 {
+			t.Errorf("query compressed records with compression off fail: %v %v", r, err)
+		}
+		return nil
+	})
+
+	//a legacy value starts with a compressor id is not misread, and ReEncrypt adds the header to the legacy values
+	legacy := []byte{headerRaw, 0x01}
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		p.Put(plain.path, EncodeUint64(5), legacy)
+		if raws, _ := packed.GetsRaw(p, EncodeUint64(5)); len(raws) != 1 || !bytes.Equal(raws[0].Value, legacy) {
+			t.Errorf("legacy value should be read as is: %v", raws)
+		}
+		if err := packed.ReEncrypt(p); err != nil {
+			t.Errorf("rewrite legacy values fail: %s", err)
+		}
+		for _, v := range stored(p) {
+			if !compressed(v) {
+				t.Errorf("value should have the header after rewrite: %x", v)
+			}
+		}
+		if raws, _ := packed.GetsRaw(p, EncodeUint64(5)); len(raws) != 1 || !bytes.Equal(raws[0].Value, legacy) {
+			t.Errorf("legacy value mismatch after rewrite: %v", raws)
+		}
+		r, err := packed.Gets(p, nil)
+		if err != nil || len(r) != 4 {
+			t.Errorf("gets after rewrite fail: %v %v", r, err)
+		}
+		return nil
+	})
+}
+
+func Test_encrypt(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	keys := StaticKeys{Current: "2024", Keys: map[string][]byte{"2024": bytes.Repeat([]byte{7}, 32)}}
+	plain, _ := New(note{}, &KVTParam{Bucket: "Bucket_note"})
+	secret, err := New(note{}, &KVTParam{Bucket: "Bucket_note", Encryption: &Encryption{Keys: keys, AllowPlain: true}})
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		plain.CreateDataBucket(p)
+		plain.CreateIndexBuckets(p)
+		secret.CreateDataBucket(p)
+		secret.CreateIndexBuckets(p)
+		plain.Put(p, &note{ID: 1, Title: "legacy"})
+		for i := 2; i <= 5; i++ {
+			if err := secret.Put(p, &note{ID: uint64(i), Title: fmt.Sprintf("secret%d", i)}); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		return nil
+	})
+
+	keyIDs := func(p Poler) (ids []string) {
+		raws, _ := plain.GetsRaw(p, nil)
+		for i := range raws {
+			ids = append(ids, encryptKeyID(raws[i].Value))
+		}
+		return ids
+	}
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		if ids := keyIDs(p); !reflect.DeepEqual(ids, []string{"", "2024", "2024", "2024", "2024"}) {
+			t.Errorf("key ids mismatch: %v", ids)
+		}
+		r, err := secret.Query(p, QueryInfo{IndexName: "idx_Title", Where: map[string][]byte{"Title": EncodeString("secret3")}})
+		if err != nil || len(r) != 1 || r[0].(*note).ID != 3 {
+			t.Errorf("query encrypted fail: %v %v", r, err)
+		}
+		if r, _ := secret.Gets(p, nil); len(r) != 5 {
+			t.Errorf("gets mixed records fail: %v", r)
+		}
+		return nil
+	})
+
+	//rotate the key, re-encrypt in chunks of 2
+	keys.Current = "2025"
+	keys.Keys["2025"] = bytes.Repeat([]byte{8}, 32)
+	rotated, _ := New(note{}, &KVTParam{Bucket: "Bucket_note", Encryption: &Encryption{Keys: keys, AllowPlain: true}})
+	strict, _ := New(note{}, &KVTParam{Bucket: "Bucket_note", Encryption: &Encryption{Keys: keys}})
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		for _, k := range []*KVT{rotated, strict} {
+			k.CreateDataBucket(p)
+			k.CreateIndexBuckets(p)
+		}
+		return nil
+	})
+	chunks := 0
+	var last []byte
+	for {
+		bdb.Update(func(tx *bolt.Tx) error {
+			p, _ := NewPoler(tx)
+			cp := &countPoler{Poler: p}
+			last, err = rotated.ReEncryptChunk(cp, ReEncryptInfo{After: last, Limit: 2})
+			if cp.scanned > 3 { //the chunk and one more to know it's not the last
+				t.Errorf("re-encrypt chunk should scan the chunk only: %d", cp.scanned)
+			}
+			return err
+		})
+		chunks++
+		if err != nil || last == nil || chunks > 5 {
+			break
+		}
+	}
+	if err != nil || chunks != 3 {
+		t.Errorf("re-encrypt fail: %d %v", chunks, err)
+	}
+
+	//the old key and plain records are gone
+	delete(keys.Keys, "2024")
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		if ids := keyIDs(p); !reflect.DeepEqual(ids, []string{"2025", "2025", "2025", "2025", "2025"}) {
+			t.Errorf("key ids after re-encrypt mismatch: %v", ids)
+		}
+		r, err := strict.Gets(p, nil)
+		if err != nil || len(r) != 5 || r[0].(*note).Title != "legacy" {
+			t.Errorf("gets re-encrypted fail: %v %v", r, err)
+		}
+		report, err := strict.Verify(p)
+		if err != nil || !report.OK() {
+			t.Errorf("indexs should be kept: %v %v", report, err)
+		}
+		return nil
+	})
+
+	//a lost key or a tampered value fails the reads, the records never vanish silently
+	lost, _ := New(note{}, &KVTParam{Bucket: "Bucket_note", Encryption: &Encryption{Keys: StaticKeys{Current: "2026", Keys: map[string][]byte{"2026": make([]byte, 32)}}}})
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		lost.CreateDataBucket(p)
+		lost.CreateIndexBuckets(p)
+		return nil
+	})
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		byTitle := RangeInfo{IndexName: "idx_Title", Where: map[string]map[string][]byte{"Title": {">=": EncodeString("")}}}
+		if _, err := lost.Gets(p, nil); err == nil {
+			t.Errorf("gets with a lost key should fail")
+		}
+		if _, err := lost.RangeQuery(p, byTitle); err == nil {
+			t.Errorf("range query with a lost key should fail")
+		}
+		if err := lost.Iterate(p, byTitle, func(obj KVer) bool { return true }); err == nil {
+			t.Errorf("iterate with a lost key should fail")
+		}
+		if err := lost.IterateGets(p, nil, func(obj KVer) bool { return true }); err == nil {
+			t.Errorf("iterate gets with a lost key should fail")
+		}
+		if _, err := lost.QueryTree(p, Cond(byTitle)); err == nil {
+			t.Errorf("query tree with a lost key should fail")
+		}
+		if _, _, err := lost.Find(p, map[string]map[string][]byte{"Title": {"=": EncodeString("secret3")}}); err == nil {
+			t.Errorf("find with a lost key should fail")
+		}
+		return nil
+	})
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		raws, _ := plain.GetsRaw(p, EncodeUint64(3))
+		tampered := bytes.Clone(raws[0].Value)
+		tampered[len(tampered)-1] ^= 1
+		p.Put(plain.path, EncodeUint64(3), tampered)
+		if _, err := strict.Gets(p, nil); err == nil {
+			t.Errorf("gets a tampered value should fail")
+		}
+		return nil
+	})
+
+	//a legacy value starts with the header byte is not misread as an encrypted one
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		for _, legacy := range [][]byte{{headerEncrypt}, {headerEncrypt, 0x01, 'x'}, append([]byte{headerEncrypt}, "kv"...)} {
+			p.Put(plain.path, EncodeUint64(9), legacy)
+			if raws, err := rotated.GetsRaw(p, EncodeUint64(9)); err != nil || len(raws) != 1 || !bytes.Equal(raws[0].Value, legacy) {
+				t.Errorf("legacy value should be read as is: %v %v", raws, err)
+			}
+			if _, err := rotated.Gets(p, EncodeUint64(9)); err != nil {
+				t.Errorf("gets legacy value fail: %s", err)
+			}
+			if _, err := strict.GetsRaw(p, EncodeUint64(9)); err == nil {
+				t.Errorf("legacy value should be rejected without AllowPlain")
+			}
+		}
+		return nil
+	})
+}
+
+func Test_writeModes(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	params := []KVTParam{
+		{Bucket: "Bucket_account"},
+		{Bucket: "Bucket_account", Codec: BinaryCodec{}, Encryption: &Encryption{Keys: StaticKeys{Current: "k", Keys: map[string][]byte{"k": make([]byte, 32)}}}},
+	}
+	for _, kp := range params {
+		k, err := New(account{}, &kp)
+		if err != nil {
+			t.Errorf("new kvt fail: %s", err)
+			return
+		}
+
+		bdb.Update(func(tx *bolt.Tx) error {
+			p, _ := NewPoler(tx)
+			k.DeleteDataBucket(p)
+			k.DeleteIndexBuckets(p)
+			k.CreateDataBucket(p)
+			k.CreateIndexBuckets(p)
+
+			var exists *ExistsError
+			var notFound *NotFoundError
+			var conflict *ConflictError
+			if err := k.Insert(p, &account{ID: 1, Owner: "ann", Balance: 10, Ver: 1}); err != nil {
+				t.Errorf("insert fail: %s", err)
+			}
+			if err := k.Insert(p, &account{ID: 1, Owner: "bob"}); !errors.As(err, &exists) || !bytes.Equal(exists.Key, EncodeUint64(1)) {
+				t.Errorf("insert an existing pk should fail with ExistsError: %v", err)
+			}
+			if err := k.Update(p, &account{ID: 2, Owner: "bob"}); !errors.As(err, &notFound) {
+				t.Errorf("update a missing pk should fail with NotFoundError: %v", err)
+			}
+			if err := k.Upsert(p, &account{ID: 2, Owner: "bob", Ver: 1}); err != nil {
+				t.Errorf("upsert fail: %s", err)
+			}
+			if err := k.Update(p, &account{ID: 2, Owner: "bob", Balance: 5, Ver: 2}); err != nil {
+				t.Errorf("update fail: %s", err)
+			}
+
+			//compare with the obj read before
+			read, _ := k.Get(p, &account{ID: 1}, nil)
+			stale := *read.(*account)
+			if err := k.CompareAndUpdate(p, &account{ID: 1, Owner: "ann", Balance: 20, Ver: 2}, read); err != nil {
+				t.Errorf("compare and update fail: %s", err)
+			}
+			if err := k.CompareAndUpdate(p, &account{ID: 1, Owner: "ann", Balance: 30, Ver: 2}, &stale); !errors.As(err, &conflict) {
+				t.Errorf("stale compare and update should fail with ConflictError: %v", err)
+			}
+			if err := k.CompareAndUpdate(p, &account{ID: 9}, &stale); !errors.As(err, &notFound) {
+				t.Errorf("compare and update a missing pk should fail with NotFoundError: %v", err)
+			}
+
+			//compare the versions
+			if err := k.UpdateVersion(p, &account{ID: 2, Owner: "bobby", Ver: 3}, 1); !errors.As(err, &conflict) || conflict.Version != 2 {
+				t.Errorf("stale version should fail with ConflictError: %v", err)
+			}
+			if err := k.UpdateVersion(p, &account{ID: 2, Owner: "bobby", Ver: 3}, 2); err != nil {
+				t.Errorf("update version fail: %s", err)
+			}
+			return nil
+		})
+
+		bdb.View(func(tx *bolt.Tx) error {
+			p, _ := NewPoler(tx)
+			r, err := k.Gets(p, nil)
+			if err != nil || len(r) != 2 || r[0].(*account).Balance != 20 || r[1].(*account).Owner != "bobby" {
+				t.Errorf("records mismatch: %v %v", r, err)
+			}
+			//the failed writes left no index
+			for owner, n := range map[string]int{"ann": 1, "bob": 0, "bobby": 1} {
+				r, _ := k.Query(p, QueryInfo{IndexName: "idx_Owner", Where: map[string][]byte{"Owner": EncodeString(owner)}})
+				if len(r) != n {
+					t.Errorf("index of %s mismatch: %v", owner, r)
+				}
+			}
+			report, err := k.Verify(p)
+			if err != nil || !report.OK() {
+				t.Errorf("verify fail: %v %v", report, err)
+			}
+			return nil
+		})
+	}
+
+	//the stored obj without a version
+	k, _ := New(note{}, &KVTParam{Bucket: "Bucket_note"})
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.CreateIndexBuckets(p)
+		k.Put(p, &note{ID: 1})
+		if err := k.UpdateVersion(p, &note{ID: 1}, 0); err == nil {
+			t.Errorf("update version of an obj without version should fail")
+		}
+
+		//gob writes the map in random order, the compare should not depend on it
+		stars := map[string]int{}
+		for i := 0; i < 20; i++ {
+			stars[fmt.Sprint("user", i)] = i
+		}
+		k.Put(p, &note{ID: 2, Stars: stars})
+		for i := 0; i < 20; i++ {
+			read, _ := k.Get(p, &note{ID: 2}, nil)
+			if err := k.CompareAndUpdate(p, &note{ID: 2, Title: fmt.Sprint(i), Stars: stars}, read); err != nil {
+				t.Errorf("compare and update with a map field fail: %v", err)
+			}
+		}
+		if err := k.CompareAndUpdate(p, &note{ID: 2, Stars: stars}, &note{ID: 2, Stars: map[string]int{"user0": 1}}); err == nil {
+			t.Errorf("a changed map should fail with ConflictError")
+		}
+		return nil
+	})
+}
+
+func Test_keyOrder(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := bolt.Open("query_test.bdb", 0600, nil)
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	k, err := New(member{}, &KVTParam{Bucket: "Bucket_Order", Unmarshal: memberUnmarshal})
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	//the levels and names contain 0x00, 0x3A(':') and 0x60('`')
+	ms := []member{
+		{ID: 1, Level: 57, Name: "item10"},
+		{ID: 2, Level: 58, Name: "A:"},
+		{ID: 3, Level: 58, Name: "A"},
+		{ID: 4, Level: 58, Name: "A B"},
+		{ID: 5, Level: 59, Name: "item1"},
+		{ID: 6, Level: 60, Name: "item10"},
+		{ID: 7, Level: 60, Name: "item1"},
+		{ID: 8, Level: 96, Name: "`"},
+		{ID: 9, Level: 96, Name: "item2"},
+	}
+	bdb.Update(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.CreateIndexBuckets(p)
+		for i := range ms {
+			ms[i].Email = fmt.Sprintf("%d@o.com", ms[i].ID)
+			if err := k.Put(p, &ms[i]); err != nil {
+				t.Errorf("put kvt fail: %s", err)
+			}
+		}
+		return nil
+	})
+
+	cmpOrder := func(result []any, err error, ids ...uint64) {
+		got := make([]uint64, 0, len(result))
+		for i := range result {
+			got = append(got, result[i].(*member).ID)
+		}
+		if err != nil || !reflect.DeepEqual(got, ids) {
+			t.Errorf("query order mismatch: %v %v %v", err, got, ids)
+		}
+	}
+
+	bdb.View(func(tx *bolt.Tx) error {
+		p, _ := NewPoler(tx)
+		r, err := k.RangeQuery(p, RangeInfo{
+			IndexName: "idx_Level_Name",
+			Where:     map[string]map[string][]byte{"Level": {">=": EncodeInt64(57)}},
+		})
+		cmpOrder(r, err, 1, 3, 4, 2, 5, 7, 6, 8, 9)
+
+		r, err = k.RangeQuery(p, RangeInfo{
+			IndexName: "idx_Level_Name",
+			Where:     map[string]map[string][]byte{"Level": {">=": EncodeInt64(58), "<=": EncodeInt64(60)}},
+		})
+		cmpOrder(r, err, 3, 4, 2, 5, 7, 6)
+
+		r, err = k.RangeQuery(p, RangeInfo{
+			IndexName: "idx_Level_Name",
+			Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(58)}, "Name": {">=": EncodeString("A")}},
+		})
+		cmpOrder(r, err, 3, 4, 2)
+
+		//top N by the reverse order
+		r, err = k.RangeQuery(p, RangeInfo{
+			IndexName: "idx_Level_Name",
+			Where:     map[string]map[string][]byte{"Level": {">=": EncodeInt64(57), "<=": EncodeInt64(60)}},
+			Reverse:   true,
+			Limit:     1,
+		})
+		cmpOrder(r, err, 6)
+
+		r, err = k.RangeQuery(p, RangeInfo{
+			IndexName: "idx_Level_Name",
+			Where:     map[string]map[string][]byte{"Level": {">=": EncodeInt64(57)}},
+			Reverse:   true,
+			Limit:     3,
+		})
+		cmpOrder(r, err, 9, 8, 6)
+
+		r, err = k.RangeQuery(p, RangeInfo{
+			IndexName: "idx_Level_Name",
+			Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(58)}},
+			Reverse:   true,
+			Offset:    1,
+			Limit:     2,
+		})
+		cmpOrder(r, err, 4, 3)
+		return nil
+	})
+}
@@ -0,0 +1,368 @@
+package kvt
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+)
+
+const errCodecType = "codec type unsupported: [%s]"
+
+const errCodecCorrupt = "codec data corrupt at %d"
+
+// the obj type registered should be a struct whose pointer is a KVer, to decode without an Unmarshal func
+const errCodecObj = "codec obj invalid: [%s], its pointer should implement KVer"
+
+// serialize the objs instead of the hand-written Value() and Unmarshal func
+type Codec interface {
+	Marshal(obj any) ([]byte, error)
+	Unmarshal(b []byte, obj any) error //obj is a pointer to decode into
+}
+
+// an obj marshals its value itself, it overrides the Codec
+type Valuer interface {
+	Value() ([]byte, error)
+}
+
+// encoding/json, readable but the largest
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(obj any) ([]byte, error) {
+	return json.Marshal(obj)
+}
+
+func (JSONCodec) Unmarshal(b []byte, obj any) error {
+	return json.Unmarshal(b, obj)
+}
+
+// encoding/gob, every value carries its type description
+type GobCodec struct{}
+
+func (GobCodec) Marshal(obj any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(obj); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(b []byte, obj any) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(obj)
+}
+
+// compact binary of the exported fields in declared order, without field names,
+// ints are varints, adding or reordering fields breaks the stored values.
+// types implementing encoding.BinaryMarshaler(time.Time...) are stored by it
+type BinaryCodec struct{}
+
+func (BinaryCodec) Marshal(obj any) ([]byte, error) {
+	//the obj pointer itself is not stored, like Unmarshal decodes into it
+	v := reflect.ValueOf(obj)
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	return appendBinary(nil, v)
+}
+
+func (BinaryCodec) Unmarshal(b []byte, obj any) error {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf(errCodecType, reflect.TypeOf(obj))
+	}
+	r := binaryReader{b: b}
+	if err := r.read(v.Elem()); err != nil {
+		return err
+	}
+	if r.off != len(b) {
+		return fmt.Errorf(errCodecCorrupt, r.off)
+	}
+	return nil
+}
+
+var binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+var binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+
+func isBinaryMarshaler(t reflect.Type) bool {
+	return t.Implements(binaryMarshalerType) && reflect.PointerTo(t).Implements(binaryUnmarshalerType)
+}
+
+func appendBinary(dst []byte, v reflect.Value) ([]byte, error) {
+	if isBinaryMarshaler(v.Type()) && v.Kind() != reflect.Pointer {
+		b, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		dst = binary.AppendUvarint(dst, uint64(len(b)))
+		return append(dst, b...), nil
+	}
+
+	var err error
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(dst, 1), nil
+		}
+		return append(dst, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(dst, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return binary.AppendUvarint(dst, v.Uint()), nil
+	case reflect.Float32:
+		return binary.LittleEndian.AppendUint32(dst, math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		return binary.LittleEndian.AppendUint64(dst, math.Float64bits(v.Float())), nil
+	case reflect.String:
+		dst = binary.AppendUvarint(dst, uint64(v.Len()))
+		return append(dst, v.String()...), nil
+	case reflect.Pointer:
+		if v.IsNil() {
+			return append(dst, 0), nil
+		}
+		return appendBinary(append(dst, 1), v.Elem())
+	case reflect.Slice:
+		//0 is a nil slice, others are the length+1
+		if v.IsNil() {
+			return append(dst, 0), nil
+		}
+		dst = binary.AppendUvarint(dst, uint64(v.Len())+1)
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append(dst, v.Bytes()...), nil
+		}
+		fallthrough
+	case reflect.Array:
+		for i := range v.Len() {
+			if dst, err = appendBinary(dst, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return dst, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return append(dst, 0), nil
+		}
+		dst = binary.AppendUvarint(dst, uint64(v.Len())+1)
+		//sort the entries by their encoded key, the same map always has the same bytes
+		entries := make([][]byte, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			entry, err := appendBinary(nil, iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			if entry, err = appendBinary(entry, iter.Value()); err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+		slices.SortFunc(entries, bytes.Compare)
+		for i := range entries {
+			dst = append(dst, entries[i]...)
+		}
+		return dst, nil
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			if dst, err = appendBinary(dst, v.Field(i)); err != nil {
+				return nil, err
+			}
+		}
+		return dst, nil
+	}
+	return nil, fmt.Errorf(errCodecType, v.Type())
+}
+
+type binaryReader struct {
+	b   []byte
+	off int
+}
+
+func (r *binaryReader) uvarint() (uint64, error) {
+	n, size := binary.Uvarint(r.b[r.off:])
+	if size <= 0 {
+		return 0, fmt.Errorf(errCodecCorrupt, r.off)
+	}
+	r.off += size
+	return n, nil
+}
+
+func (r *binaryReader) next(n uint64) ([]byte, error) {
+	if n > uint64(len(r.b)-r.off) {
+		return nil, fmt.Errorf(errCodecCorrupt, r.off)
+	}
+	b := r.b[r.off : r.off+int(n)]
+	r.off += int(n)
+	return b, nil
+}
+
+func (r *binaryReader) read(v reflect.Value) error {
+	if isBinaryMarshaler(v.Type()) && v.Kind() != reflect.Pointer {
+		n, err := r.uvarint()
+		if err != nil {
+			return err
+		}
+		b, err := r.next(n)
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(b)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := r.next(1)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b[0] != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, size := binary.Varint(r.b[r.off:])
+		if size <= 0 || v.OverflowInt(n) {
+			return fmt.Errorf(errCodecCorrupt, r.off)
+		}
+		r.off += size
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		off := r.off
+		n, err := r.uvarint()
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(n) {
+			return fmt.Errorf(errCodecCorrupt, off)
+		}
+		v.SetUint(n)
+	case reflect.Float32:
+		b, err := r.next(4)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+	case reflect.Float64:
+		b, err := r.next(8)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+	case reflect.String:
+		n, err := r.uvarint()
+		if err != nil {
+			return err
+		}
+		b, err := r.next(n)
+		if err != nil {
+			return err
+		}
+		v.SetString(string(b))
+	case reflect.Pointer:
+		b, err := r.next(1)
+		if err != nil {
+			return err
+		}
+		if b[0] == 0 {
+			v.SetZero()
+			return nil
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		return r.read(v.Elem())
+	case reflect.Slice:
+		n, err := r.uvarint()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			v.SetZero()
+			return nil
+		}
+		n--
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := r.next(n)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(bytes.Clone(b))
+			return nil
+		}
+		if n > uint64(len(r.b)-r.off) { //every element takes 1 byte at least
+			return fmt.Errorf(errCodecCorrupt, r.off)
+		}
+		v.Set(reflect.MakeSlice(v.Type(), int(n), int(n)))
+		return r.readElems(v)
+	case reflect.Array:
+		return r.readElems(v)
+	case reflect.Map:
+		n, err := r.uvarint()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			v.SetZero()
+			return nil
+		}
+		n--
+		if n > uint64(len(r.b)-r.off) {
+			return fmt.Errorf(errCodecCorrupt, r.off)
+		}
+		t := v.Type()
+		v.Set(reflect.MakeMapWithSize(t, int(n)))
+		for range n {
+			key, value := reflect.New(t.Key()).Elem(), reflect.New(t.Elem()).Elem()
+			if err := r.read(key); err != nil {
+				return err
+			}
+			if err := r.read(value); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			if err := r.read(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf(errCodecType, v.Type())
+	}
+	return nil
+}
+
+func (r *binaryReader) readElems(v reflect.Value) error {
+	for i := range v.Len() {
+		if err := r.read(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the value bytes of obj, from its Value() first, otherwise the Codec
+func (kvt *KVT) value(obj KVer) ([]byte, error) {
+	if v, ok := obj.(Valuer); ok {
+		return v.Value()
+	}
+	return kvt.codec.Marshal(obj)
+}
+
+// the DecodeFunc by the Codec, when no Unmarshal func given, dst is reused if it's not nil
+func (kvt *KVT) codecUnmarshal(b []byte, dst KVer) (KVer, error) {
+	if v := reflect.ValueOf(dst); !v.IsValid() || (v.Kind() == reflect.Pointer && v.IsNil()) {
+		dst = reflect.New(kvt.typ).Interface().(KVer)
+	}
+	if err := kvt.codec.Unmarshal(b, dst); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
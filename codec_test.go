@@ -0,0 +1,117 @@
+package kvt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	at := time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)
+	src := &note{
+		ID:    7,
+		Title: "hello",
+		At:    at,
+		Stars: map[string]int{"a": 1, "b": -2},
+		Refs:  []uint64{1, 1 << 40},
+		Prev:  &note{ID: 6, Title: "prev", Refs: []uint64{}},
+		skip:  3,
+	}
+	for _, codec := range []Codec{JSONCodec{}, GobCodec{}, BinaryCodec{}} {
+		b, err := codec.Marshal(src)
+		if err != nil {
+			t.Errorf("%T marshal fail: %s", codec, err)
+			continue
+		}
+		dst := new(note)
+		if err := codec.Unmarshal(b, dst); err != nil {
+			t.Errorf("%T unmarshal fail: %s", codec, err)
+			continue
+		}
+		if dst.ID != src.ID || dst.Title != src.Title || !dst.At.Equal(at) || !reflect.DeepEqual(dst.Stars, src.Stars) ||
+			!reflect.DeepEqual(dst.Refs, src.Refs) || dst.Prev == nil || dst.Prev.Title != "prev" || dst.skip != 0 {
+			t.Errorf("%T round trip mismatch: %+v", codec, dst)
+		}
+	}
+}
+
+func TestBinaryCodec(t *testing.T) {
+	type sample struct {
+		I8    int8
+		U     uint
+		F32   float32
+		B     bool
+		Raw   []byte
+		Nil   []string
+		Empty []string
+		Arr   [2]int16
+	}
+	src := sample{I8: -3, U: 300, F32: 1.5, B: true, Raw: []byte{0, 1}, Empty: []string{}, Arr: [2]int16{-1, 1}}
+	b, err := BinaryCodec{}.Marshal(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dst sample
+	if err := (BinaryCodec{}).Unmarshal(b, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(src, dst) {
+		t.Errorf("binary round trip mismatch:\n%+v\n%+v", src, dst)
+	}
+	if dst.Nil != nil || dst.Empty == nil {
+		t.Errorf("nil and empty slice should be kept")
+	}
+
+	//the map entries are sorted, the same obj has the same bytes
+	m := &note{Stars: map[string]int{"x": 1, "y": 2, "z": 3, "w": 4}}
+	first, _ := BinaryCodec{}.Marshal(m)
+	for range 10 {
+		if again, _ := (BinaryCodec{}).Marshal(m); !bytes.Equal(first, again) {
+			t.Fatalf("binary codec is not deterministic")
+		}
+	}
+
+	gob, _ := GobCodec{}.Marshal(m)
+	if len(first) >= len(gob) {
+		t.Errorf("binary codec should be smaller than gob: %d %d", len(first), len(gob))
+	}
+
+	for i := range b {
+		if err := (BinaryCodec{}).Unmarshal(b[:i], &dst); err == nil {
+			t.Errorf("truncated data at %d should fail", i)
+		}
+	}
+	if err := (BinaryCodec{}).Unmarshal(append(b, 0), &dst); err == nil {
+		t.Errorf("trailing data should fail")
+	}
+	if _, err := (BinaryCodec{}).Marshal(struct{ C chan int }{}); err == nil {
+		t.Errorf("chan should be unsupported")
+	}
+}
+
+func TestCodecKVT(t *testing.T) {
+	if _, err := New(struct{ ID int }{}, &KVTParam{Bucket: "Bucket_anon"}); err == nil {
+		t.Errorf("a struct without KVer pointer needs an Unmarshal func")
+	}
+
+	k, err := New(note{}, &KVTParam{Bucket: "Bucket_note", Codec: BinaryCodec{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := k.value(&note{ID: 1, Title: "t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := k.unmarshal(b, nil)
+	if n, ok := obj.(*note); err != nil || !ok || n.Title != "t" {
+		t.Errorf("codec unmarshal fail: %v %v", obj, err)
+	}
+
+	//Value() overrides the Codec
+	m := &member{ID: 1, Name: "m"}
+	want, _ := m.Value()
+	if got, _ := k.value(m); !bytes.Equal(got, want) {
+		t.Errorf("Value() should override the codec")
+	}
+}
@@ -0,0 +1,131 @@
+package kvt
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// builtin operators can't be replaced, the query plan depends on them
+const errOperatorConflict = "compare operator conflict: [%s], builtin operator can't be replaced"
+
+// a field's collation and operators, used by every index on the field and by Find
+type FieldInfo struct {
+	Collate   CollateFunc                 //index keys and compares use the collated value, nil means raw bytes
+	Operators map[string]CompareFunc      //compare operators of this field only
+	Encode    func(v any) ([]byte, error) //encode a text query literal for a hand-written index key, nil means the field type's encoder
+}
+
+// case insensitive collation of an utf8 string
+func CollateFold(v []byte) []byte {
+	return bytes.ToLower(v)
+}
+
+// numeric aware collation, digits compare by their number value, "a2" < "a10"
+func CollateNatural(v []byte) []byte {
+	key := make([]byte, 0, len(v)+4)
+	for i := 0; i < len(v); {
+		if v[i] < '0' || v[i] > '9' {
+			key = append(key, v[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(v) && v[j] >= '0' && v[j] <= '9' {
+			j++
+		}
+		digits := bytes.TrimLeft(v[i:j], "0")
+		if len(digits) == 0 {
+			digits = []byte{'0'}
+		}
+		//a longer number is larger, so the length goes first, it's a digit too to keep the order with other chars
+		n := strconv.Itoa(len(digits))
+		key = append(key, byte('0'+len(n)))
+		key = append(key, n...)
+		key = append(key, digits...)
+		i = j
+	}
+	return key
+}
+
+// collate the where value like the stored field value, custom operators get the raw value
+func collateWhere(collate CollateFunc, op string, v []byte) []byte {
+	if collate == nil {
+		return v
+	}
+	switch op {
+	case "in", "not in", "between":
+		values := SplitValues(v)
+		for i := range values {
+			values[i] = collate(values[i])
+		}
+		return MakeValues(values...)
+	case "=", "==", "!=", "<", ">", "<=", ">=", "prefix":
+		return collate(v)
+	}
+	return v
+}
+
+// the compare func of the operator on the field, the field's operators first, then the KVT's, then the builtin
+func (kvt *KVT) compareFunc(field, op string) (CompareFunc, bool) {
+	name := cmpOperator(op)
+	if fn, ok := kvt.fields[field].Operators[name]; ok {
+		return fn, true
+	}
+	if fn, ok := kvt.operators[name]; ok {
+		return fn, true
+	}
+	fn, ok := cmpFunctionDict[name]
+	return fn, ok
+}
+
+func saveOperators(dst, src map[string]CompareFunc) error {
+	for op, fn := range src {
+		name := cmpOperator(op)
+		if _, ok := cmpFunctionDict[name]; ok || fn == nil {
+			return fmt.Errorf(errOperatorConflict, op)
+		}
+		dst[name] = fn
+	}
+	return nil
+}
+
+// save the custom operators and field infos, set the collation of every index field
+func (kvt *KVT) saveFields(kp *KVTParam, allFields map[string]struct{}) error {
+	kvt.operators = make(map[string]CompareFunc, len(kp.Operators))
+	if err := saveOperators(kvt.operators, kp.Operators); err != nil {
+		return err
+	}
+
+	kvt.fields = make(map[string]FieldInfo, len(kp.Fields))
+	for name, f := range kp.Fields {
+		if _, ok := allFields[name]; !ok {
+			return fmt.Errorf(errIndexFieldMismatch, name)
+		}
+		info := FieldInfo{Collate: f.Collate, Encode: f.Encode, Operators: make(map[string]CompareFunc, len(f.Operators))}
+		if err := saveOperators(info.Operators, f.Operators); err != nil {
+			return err
+		}
+		kvt.fields[name] = info
+	}
+
+	save := func(index *IndexInfo) {
+		for i := range index.Fields {
+			collate := kvt.fields[index.Fields[i]].Collate
+			if collate == nil {
+				continue
+			}
+			if index.collate == nil {
+				index.collate = make([]CollateFunc, len(index.Fields))
+			}
+			index.collate[i] = collate
+		}
+	}
+	for _, index := range kvt.indexs {
+		save(index)
+	}
+	for _, mindex := range kvt.mindexs {
+		save(mindex.IndexInfo)
+	}
+	return nil
+}
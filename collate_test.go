@@ -0,0 +1,25 @@
+package kvt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCollateNatural(t *testing.T) {
+	sorted := []string{"", "0", "a", "a1", "a01b", "a2", "a9", "a10", "a10b", "a100", "b", "file007", "file8", "file12345678901"}
+	for i := 1; i < len(sorted); i++ {
+		x, y := CollateNatural([]byte(sorted[i-1])), CollateNatural([]byte(sorted[i]))
+		if bytes.Compare(x, y) >= 0 {
+			t.Errorf("natural order mismatch: %q %q", sorted[i-1], sorted[i])
+		}
+	}
+	if !bytes.Equal(CollateNatural([]byte("a007")), CollateNatural([]byte("a7"))) {
+		t.Errorf("leading zeros should be ignored")
+	}
+}
+
+func TestCollateFold(t *testing.T) {
+	if !bytes.Equal(CollateFold([]byte("AbC")), CollateFold([]byte("aBc"))) {
+		t.Errorf("fold should ignore case")
+	}
+}
@@ -0,0 +1,240 @@
+package kvt
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// the header of a packed value is the compressor id and the magic, a value without it is a legacy one
+// stored before compression on, it's read as is, and ReEncrypt rewrites it with the header
+const (
+	headerRaw   byte = 0xE0 //stored as is
+	headerFlate byte = 0xE1
+	headerGzip  byte = 0xE2
+	headerMax   byte = 0xEF //custom compressors use (headerGzip, headerMax]
+)
+
+// follows the compressor id, a legacy value is misread only if it starts with an id and the magic
+const compressMagic = "kvz"
+
+const compressHeaderLen = 1 + len(compressMagic)
+
+const errCompressorID = "compressor id invalid: [%#x], custom compressor should use 0xE3~0xEF"
+
+const errCompressorUnknown = "compressor unknown: [%#x], add it to Compression.Others"
+
+// compress the values before Poler.Put, and decompress them before DecodeFunc
+type Compressor interface {
+	ID() byte //the header byte of the values it compresses
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+// opt-in value compression, set KVTParam.Compression to turn it on.
+// values smaller than MinSize or not shrunk are stored raw, with a header byte too,
+// a nil Compressor stores all the values raw, but still reads the compressed ones.
+// a nil KVTParam.Compression still reads the flate/gzip values, but the custom compressed ones fail,
+// keep them readable with a nil Compressor and their Compressor in Others
+type Compression struct {
+	Compressor Compressor   //compress the new values
+	MinSize    int          //values shorter than it are stored raw
+	Others     []Compressor //custom compressors of the old values, flate and gzip are always known
+}
+
+// compress/flate, Level 0 means flate.DefaultCompression
+type FlateCompressor struct {
+	Level int
+}
+
+func (FlateCompressor) ID() byte {
+	return headerFlate
+}
+
+func (c FlateCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, compressLevel(c.Level))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (FlateCompressor) Decompress(src []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// compress/gzip, Level 0 means gzip.DefaultCompression
+type GzipCompressor struct {
+	Level int
+}
+
+func (GzipCompressor) ID() byte {
+	return headerGzip
+}
+
+func (c GzipCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, compressLevel(c.Level))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GzipCompressor) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func compressLevel(level int) int {
+	if level == 0 {
+		return flate.DefaultCompression
+	}
+	return level
+}
+
+// check the custom compressors, and index all the compressors by their id,
+// flate and gzip are known without Compression, the values compressed before it's off are still read
+func (kvt *KVT) saveCompression(c *Compression) error {
+	kvt.compressors = map[byte]Compressor{headerFlate: FlateCompressor{}, headerGzip: GzipCompressor{}}
+	if c == nil {
+		return nil
+	}
+	kvt.compression = c
+	all := append([]Compressor{}, c.Others...)
+	if c.Compressor != nil {
+		all = append(all, c.Compressor)
+	}
+	for _, comp := range all {
+		id := comp.ID()
+		switch {
+		case id == headerFlate || id == headerGzip:
+		case id > headerGzip && id <= headerMax:
+			kvt.compressors[id] = comp
+		default:
+			return fmt.Errorf(errCompressorID, id)
+		}
+	}
+	return nil
+}
+
+// compress the value with a header byte if compression is on
+func (kvt *KVT) compress(value []byte) ([]byte, error) {
+	c := kvt.compression
+	if c == nil {
+		return value, nil
+	}
+	if c.Compressor != nil && len(value) >= c.MinSize {
+		packed, err := c.Compressor.Compress(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(packed)+compressHeaderLen < len(value) {
+			return append(compressHeader(c.Compressor.ID()), packed...), nil
+		}
+	}
+	return append(compressHeader(headerRaw), value...), nil
+}
+
+func compressHeader(id byte) []byte {
+	return append([]byte{id}, compressMagic...)
+}
+
+// true if the stored value has the header of compress
+func compressed(stored []byte) bool {
+	return len(stored) >= compressHeaderLen && stored[0] >= headerRaw && stored[0] <= headerMax &&
+		string(stored[1:compressHeaderLen]) == compressMagic
+}
+
+// reverse of compress, the magic tells the compressed values even if compression is off now
+func (kvt *KVT) decompress(stored []byte) ([]byte, error) {
+	if !compressed(stored) {
+		return stored, nil
+	}
+	if stored[0] == headerRaw {
+		return stored[compressHeaderLen:], nil
+	}
+	comp, ok := kvt.compressors[stored[0]]
+	if !ok {
+		return nil, fmt.Errorf(errCompressorUnknown, stored[0])
+	}
+	return comp.Decompress(stored[compressHeaderLen:])
+}
+
+// the stored bytes of a value, compressed then encrypted
+func (kvt *KVT) pack(pk, value []byte) ([]byte, error) {
+	v, err := kvt.compress(value)
+	if err != nil {
+		return nil, err
+	}
+	return kvt.encrypt(pk, v)
+}
+
+// the value bytes of the stored bytes, reverse of pack
+func (kvt *KVT) unpack(pk, stored []byte) ([]byte, error) {
+	v, err := kvt.decrypt(pk, stored)
+	if err != nil {
+		return nil, err
+	}
+	return kvt.decompress(v)
+}
+
+// unpack the raw values in place, offset is the bucket prefix length of their keys
+func (kvt *KVT) unpackRaws(raws []KVPair, offset int) ([]KVPair, error) {
+	for i := range raws {
+		v, err := kvt.unpack(raws[i].Key[offset:], raws[i].Value)
+		if err != nil {
+			return nil, err
+		}
+		raws[i].Value = v
+	}
+	return raws, nil
+}
+
+// decode the stored bytes of pk to an obj
+func (kvt *KVT) load(pk, stored []byte, dst KVer) (KVer, error) {
+	v, err := kvt.unpack(pk, stored)
+	if err != nil {
+		return nil, err
+	}
+	return kvt.unmarshal(v, dst)
+}
+
+// decode the stored bytes of a pk found by a query, a missing record(stale index entry) or a value
+// the DecodeFunc rejects is skipped with a nil obj, but the decompress and decrypt errors are returned,
+// a record should not vanish silently because its key is lost or it's tampered
+func (kvt *KVT) tryLoad(pk, stored []byte) (KVer, error) {
+	if len(stored) == 0 {
+		return nil, nil
+	}
+	v, err := kvt.unpack(pk, stored)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := kvt.unmarshal(v, nil)
+	if err != nil {
+		return nil, nil
+	}
+	return obj, nil
+}
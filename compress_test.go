@@ -0,0 +1,93 @@
+package kvt
+
+import (
+	"bytes"
+	"testing"
+)
+
+// a custom compressor for test only, it keeps the first byte of a value repeated 100 times
+type repeatCompressor struct{}
+
+func (repeatCompressor) ID() byte {
+	return 0xE5
+}
+
+func (repeatCompressor) Compress(src []byte) ([]byte, error) {
+	return src[:1], nil
+}
+
+func (repeatCompressor) Decompress(src []byte) ([]byte, error) {
+	return bytes.Repeat(src[:1], 100), nil
+}
+
+func TestCompress(t *testing.T) {
+	repeated := bytes.Repeat([]byte("abcdefgh"), 100)
+	for _, comp := range []Compressor{FlateCompressor{}, GzipCompressor{Level: 9}, nil} {
+		k, err := New(note{}, &KVTParam{Bucket: "Bucket_note", Compression: &Compression{Compressor: comp, MinSize: 16}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range [][]byte{repeated, []byte("short"), {headerRaw}, {}} {
+			packed, err := k.compress(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if comp != nil && len(v) >= 16 && (packed[0] != comp.ID() || len(packed) >= len(v)) {
+				t.Errorf("%T should compress: %d %d", comp, len(packed), len(v))
+			}
+			if (comp == nil || len(v) < 16) && packed[0] != headerRaw {
+				t.Errorf("%T should store raw: %x", comp, packed)
+			}
+			unpacked, err := k.decompress(packed)
+			if err != nil || !bytes.Equal(unpacked, v) {
+				t.Errorf("%T unpack mismatch: %v", comp, err)
+			}
+		}
+
+		//a legacy value without header is read as is, even if it starts with a compressor id
+		for _, legacy := range [][]byte{[]byte("{legacy}"), {headerRaw, 0x01}, {headerFlate, 'k', 'v'}, {headerRaw}} {
+			if v, err := k.decompress(legacy); err != nil || !bytes.Equal(v, legacy) {
+				t.Errorf("legacy value mismatch: %q %v", v, err)
+			}
+		}
+	}
+
+	//flate and gzip are always known, custom compressors need to be given
+	gzipped, _ := (&KVT{compression: &Compression{Compressor: GzipCompressor{}}}).compress(repeated)
+	k, _ := New(note{}, &KVTParam{Bucket: "Bucket_note", Compression: &Compression{}})
+	if v, err := k.decompress(gzipped); err != nil || !bytes.Equal(v, repeated) {
+		t.Errorf("gzip value should be read without the compressor: %v", err)
+	}
+	custom := append(compressHeader(0xE5), 'x')
+	if _, err := k.decompress(custom); err == nil {
+		t.Errorf("unknown compressor should fail")
+	}
+	k, _ = New(note{}, &KVTParam{Bucket: "Bucket_note", Compression: &Compression{Others: []Compressor{repeatCompressor{}}}})
+	if v, err := k.decompress(custom); err != nil || len(v) != 100 {
+		t.Errorf("custom compressor in Others should decode: %v", err)
+	}
+
+	//compression off, the compressed values are still read, the custom ones fail instead of being misread
+	k, _ = New(note{}, &KVTParam{Bucket: "Bucket_note"})
+	if v, err := k.decompress(gzipped); err != nil || !bytes.Equal(v, repeated) {
+		t.Errorf("gzip value should be read when compression is off: %v", err)
+	}
+	if _, err := k.decompress(custom); err == nil {
+		t.Errorf("unknown compressor should fail when compression is off")
+	}
+	if v, err := k.decompress(repeated); err != nil || !bytes.Equal(v, repeated) {
+		t.Errorf("value without the header should be kept: %v", err)
+	}
+
+	if _, err := New(note{}, &KVTParam{Bucket: "Bucket_note", Compression: &Compression{Compressor: badIDCompressor{}}}); err == nil {
+		t.Errorf("compressor id out of range should fail")
+	}
+}
+
+type badIDCompressor struct {
+	repeatCompressor
+}
+
+func (badIDCompressor) ID() byte {
+	return 0x01
+}
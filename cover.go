@@ -0,0 +1,123 @@
+package kvt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+// a covering index stores a projection of the obj in the index value, besides the pk
+const errIndexNotCovering = "index is not covering: [%s]"
+
+// true if the index value carries a projection
+func (idx *IndexInfo) covering() bool {
+	return len(idx.Cover) > 0 || idx.Project != nil
+}
+
+// the projection of obj, from the Project func first, otherwise the Cover fields
+func (idx *IndexInfo) projection(obj KVer) ([]byte, error) {
+	if idx.Project != nil {
+		return idx.Project(obj)
+	}
+	v := structValue(obj)
+	proj := make([]byte, 0, 20)
+	for i := range idx.Cover {
+		fv := v.FieldByName(idx.Cover[i])
+		if !fv.IsValid() {
+			return nil, fmt.Errorf(errIndexFieldMismatch, idx.Name)
+		}
+		b, err := encodeReflect(fv)
+		if err != nil {
+			return nil, err
+		}
+		proj = MakeIndexKey(proj, b)
+	}
+	return proj, nil
+}
+
+// the value saved with the index key, pk only for a plain index,
+// uvarint(len(pk)) + pk + projection for a covering index
+func (idx *IndexInfo) indexValue(obj KVer, pk []byte) ([]byte, error) {
+	if !idx.covering() {
+		return pk, nil
+	}
+	proj, err := idx.projection(obj)
+	if err != nil {
+		return nil, err
+	}
+	v := make([]byte, 0, binary.MaxVarintLen64+len(pk)+len(proj))
+	v = binary.AppendUvarint(v, uint64(len(pk)))
+	v = append(v, pk...)
+	return append(v, proj...), nil
+}
+
+// split the index value into pk and projection
+func (idx *IndexInfo) splitValue(v []byte) (pk, proj []byte) {
+	if !idx.covering() {
+		return v, nil
+	}
+	n, l := binary.Uvarint(v)
+	if l <= 0 || uint64(len(v)-l) < n {
+		return v, nil
+	}
+	return v[l : l+int(n)], v[l+int(n):]
+}
+
+// the cover fields should exist and be encodable, the Project func takes over them
+func checkCoverEncodable(t reflect.Type, index *IndexInfo) error {
+	if index.Project != nil {
+		return nil
+	}
+	for _, name := range index.Cover {
+		if f, ok := t.FieldByName(name); !ok || !encodableType(f.Type) {
+			return fmt.Errorf(errFieldNotEncodable, name, index.Name)
+		}
+	}
+	return nil
+}
+
+// query by a covering index, return the (pk, projection) pairs from the index only, never read the data bucket
+func (kvt *KVT) RangeQueryCover(db Poler, rangeInfo RangeInfo) (result []KVPair, err error) {
+
+	plan, err := kvt.makeQueryPlan(rangeInfo)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.index.covering() {
+		return nil, fmt.Errorf(errIndexNotCovering, rangeInfo.IndexName)
+	}
+
+	result = make([]KVPair, 0)
+	err = kvt.scanIndexValue(db, rangeInfo, plan, func(k, v []byte) bool {
+		pk, proj := plan.index.splitValue(v)
+		result = append(result, KVPair{Key: bytes.Clone(pk), Value: bytes.Clone(proj)})
+		return true
+	})
+	return result, err
+}
+
+// simple query by a covering index, see RangeQueryCover
+func (kvt *KVT) QueryCover(db Poler, info QueryInfo) (result []KVPair, err error) {
+	return kvt.RangeQueryCover(db, info.rangeInfo())
+}
+
+// split the projection of Cover fields into (fieldName, value) pairs
+func (kvt *KVT) CoverFields(indexName string, proj []byte) (map[string][]byte, error) {
+	index, err := kvt.getIndexInfo(indexName)
+	if err != nil {
+		return nil, err
+	}
+	if len(index.Cover) == 0 || index.Project != nil {
+		return nil, fmt.Errorf(errIndexNotCovering, indexName)
+	}
+	values := SplitIndexKey(proj)
+	if len(values) != len(index.Cover) {
+		return nil, fmt.Errorf(errIndexFieldMismatch, indexName)
+	}
+	result := make(map[string][]byte, len(index.Cover))
+	for i := range index.Cover {
+		result[index.Cover[i]] = values[i]
+	}
+	return result, nil
+}
@@ -0,0 +1,265 @@
+package kvt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// order preserving key encoders, bytes.Compare of the encoded keys
+// give the same order as the values, and the keys are portable across architectures.
+// all the integers are fixed width big endian, signed integers flip the sign bit,
+// floats flip the sign bit for positive and all the bits for negative.
+
+const errDecodeLength = "decode key failed: need %d bytes, got %d"
+const errEncodeTypeInvalid = "encode key failed: type [%T] is not supported"
+const errDecodeDesc = "decode descending key failed: invalid tail"
+
+const signBit64 = 1 << 63
+
+func EncodeUint8(v uint8) []byte {
+	return []byte{v}
+}
+
+func EncodeUint16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(make([]byte, 0, 2), v)
+}
+
+func EncodeUint32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(make([]byte, 0, 4), v)
+}
+
+func EncodeUint64(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(make([]byte, 0, 8), v)
+}
+
+func EncodeInt8(v int8) []byte {
+	return []byte{uint8(v) ^ 0x80}
+}
+
+func EncodeInt16(v int16) []byte {
+	return EncodeUint16(uint16(v) ^ 0x8000)
+}
+
+func EncodeInt32(v int32) []byte {
+	return EncodeUint32(uint32(v) ^ 0x80000000)
+}
+
+func EncodeInt64(v int64) []byte {
+	return EncodeUint64(uint64(v) ^ signBit64)
+}
+
+func EncodeFloat32(v float32) []byte {
+	b := math.Float32bits(v)
+	if b&0x80000000 != 0 {
+		b = ^b
+	} else {
+		b ^= 0x80000000
+	}
+	return EncodeUint32(b)
+}
+
+func EncodeFloat64(v float64) []byte {
+	b := math.Float64bits(v)
+	if b&signBit64 != 0 {
+		b = ^b
+	} else {
+		b ^= signBit64
+	}
+	return EncodeUint64(b)
+}
+
+func EncodeBool(v bool) []byte {
+	if v {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// unix seconds(as int64) + nanoseconds(as uint32), location is dropped
+func EncodeTime(v time.Time) []byte {
+	return binary.BigEndian.AppendUint32(EncodeInt64(v.Unix()), uint32(v.Nanosecond()))
+}
+
+func EncodeString(v string) []byte {
+	return []byte(v)
+}
+
+func EncodeBytes(v []byte) []byte {
+	return append([]byte{}, v...)
+}
+
+func checkLength(b []byte, n int) error {
+	if len(b) != n {
+		return fmt.Errorf(errDecodeLength, n, len(b))
+	}
+	return nil
+}
+
+func DecodeUint8(b []byte) (uint8, error) {
+	if err := checkLength(b, 1); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func DecodeUint16(b []byte) (uint16, error) {
+	if err := checkLength(b, 2); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+func DecodeUint32(b []byte) (uint32, error) {
+	if err := checkLength(b, 4); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func DecodeUint64(b []byte) (uint64, error) {
+	if err := checkLength(b, 8); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func DecodeInt8(b []byte) (int8, error) {
+	v, err := DecodeUint8(b)
+	return int8(v ^ 0x80), err
+}
+
+func DecodeInt16(b []byte) (int16, error) {
+	v, err := DecodeUint16(b)
+	return int16(v ^ 0x8000), err
+}
+
+func DecodeInt32(b []byte) (int32, error) {
+	v, err := DecodeUint32(b)
+	return int32(v ^ 0x80000000), err
+}
+
+func DecodeInt64(b []byte) (int64, error) {
+	v, err := DecodeUint64(b)
+	return int64(v ^ signBit64), err
+}
+
+func DecodeFloat32(b []byte) (float32, error) {
+	v, err := DecodeUint32(b)
+	if err != nil {
+		return 0, err
+	}
+	if v&0x80000000 != 0 {
+		v ^= 0x80000000
+	} else {
+		v = ^v
+	}
+	return math.Float32frombits(v), nil
+}
+
+func DecodeFloat64(b []byte) (float64, error) {
+	v, err := DecodeUint64(b)
+	if err != nil {
+		return 0, err
+	}
+	if v&signBit64 != 0 {
+		v ^= signBit64
+	} else {
+		v = ^v
+	}
+	return math.Float64frombits(v), nil
+}
+
+func DecodeBool(b []byte) (bool, error) {
+	v, err := DecodeUint8(b)
+	return v != 0, err
+}
+
+// the time is in UTC
+func DecodeTime(b []byte) (time.Time, error) {
+	if err := checkLength(b, 12); err != nil {
+		return time.Time{}, err
+	}
+	sec, _ := DecodeInt64(b[:8])
+	return time.Unix(sec, int64(binary.BigEndian.Uint32(b[8:]))).UTC(), nil
+}
+
+func DecodeString(b []byte) (string, error) {
+	return string(b), nil
+}
+
+func DecodeBytes(b []byte) ([]byte, error) {
+	return append([]byte{}, b...), nil
+}
+
+// invert the bytes for a descending field, 0x00 is escaped to 0xFF 0x00 and a 0xFF 0xFF tail is added,
+// to keep the order of the values which have a common prefix, eg: "ab" before "a", and "a\x00" before "a"
+func EncodeDesc(v []byte) []byte {
+	d := make([]byte, 0, len(v)+2)
+	for i := range v {
+		if v[i] == 0 {
+			d = append(d, 0xFF, 0x00)
+			continue
+		}
+		d = append(d, ^v[i])
+	}
+	return append(d, 0xFF, 0xFF)
+}
+
+func DecodeDesc(b []byte) ([]byte, error) {
+	v := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] != 0xFF:
+			v = append(v, ^b[i])
+		case i+1 < len(b) && b[i+1] == 0x00: //escaped 0x00
+			v = append(v, 0)
+			i++
+		case i+2 == len(b) && b[i+1] == 0xFF: //the tail
+			return v, nil
+		default:
+			return nil, fmt.Errorf(errDecodeDesc)
+		}
+	}
+	return nil, fmt.Errorf(errDecodeDesc)
+}
+
+// encode a value with the encoder of its type, int/uint are encoded as 64 bits
+func EncodeValue(v any) ([]byte, error) {
+	switch t := v.(type) {
+	case uint8:
+		return EncodeUint8(t), nil
+	case uint16:
+		return EncodeUint16(t), nil
+	case uint32:
+		return EncodeUint32(t), nil
+	case uint64:
+		return EncodeUint64(t), nil
+	case uint:
+		return EncodeUint64(uint64(t)), nil
+	case int8:
+		return EncodeInt8(t), nil
+	case int16:
+		return EncodeInt16(t), nil
+	case int32:
+		return EncodeInt32(t), nil
+	case int64:
+		return EncodeInt64(t), nil
+	case int:
+		return EncodeInt64(int64(t)), nil
+	case float32:
+		return EncodeFloat32(t), nil
+	case float64:
+		return EncodeFloat64(t), nil
+	case bool:
+		return EncodeBool(t), nil
+	case time.Time:
+		return EncodeTime(t), nil
+	case string:
+		return EncodeString(t), nil
+	case []byte:
+		return EncodeBytes(t), nil
+	}
+	return nil, fmt.Errorf(errEncodeTypeInvalid, v)
+}
@@ -0,0 +1,165 @@
+package kvt
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+func Test_encodeOrder(t *testing.T) {
+
+	//every list is in ascending order
+	cases := map[string][]any{
+		"uint8":   {uint8(0), uint8(1), uint8(200), uint8(math.MaxUint8)},
+		"uint16":  {uint16(0), uint16(255), uint16(256), uint16(math.MaxUint16)},
+		"uint32":  {uint32(0), uint32(1), uint32(1 << 20), uint32(math.MaxUint32)},
+		"uint64":  {uint64(0), uint64(255), uint64(256), uint64(math.MaxUint64)},
+		"int8":    {int8(math.MinInt8), int8(-1), int8(0), int8(1), int8(math.MaxInt8)},
+		"int16":   {int16(math.MinInt16), int16(-256), int16(-1), int16(0), int16(255), int16(math.MaxInt16)},
+		"int32":   {int32(math.MinInt32), int32(-1), int32(0), int32(1), int32(math.MaxInt32)},
+		"int64":   {int64(math.MinInt64), int64(-1000), int64(-1), int64(0), int64(1), int64(math.MaxInt64)},
+		"int":     {-300, -2, 0, 2, 300},
+		"float32": {float32(math.Inf(-1)), float32(-2.5), float32(-0.1), float32(0), float32(0.1), float32(3), float32(math.Inf(1))},
+		"float64": {math.Inf(-1), -1e10, -2.5, -0.1, 0.0, 0.1, 3.0, 1e10, math.Inf(1)},
+		"bool":    {false, true},
+		"time": {
+			time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(1969, 12, 31, 23, 59, 59, 999, time.UTC),
+			time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(1970, 1, 1, 0, 0, 0, 1, time.UTC),
+			time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		},
+		"string": {"", "A", "Al", "Alice", "b"},
+	}
+
+	for name, values := range cases {
+		var prev []byte
+		for i := range values {
+			k, err := EncodeValue(values[i])
+			if err != nil {
+				t.Errorf("%s encode %v fail: %s", name, values[i], err)
+				continue
+			}
+			if i > 0 && bytes.Compare(prev, k) >= 0 {
+				t.Errorf("%s order mismatch: %v should less than %v", name, values[i-1], values[i])
+			}
+			prev = k
+		}
+	}
+
+	if _, err := EncodeValue(struct{}{}); err == nil {
+		t.Errorf("encode unsupported type should fail")
+	}
+}
+
+func Test_encodeDecode(t *testing.T) {
+
+	if v, err := DecodeInt64(EncodeInt64(-12345)); err != nil || v != -12345 {
+		t.Errorf("int64 decode fail: %d %v", v, err)
+	}
+	if v, err := DecodeInt16(EncodeInt16(-2)); err != nil || v != -2 {
+		t.Errorf("int16 decode fail: %d %v", v, err)
+	}
+	if v, err := DecodeUint32(EncodeUint32(77)); err != nil || v != 77 {
+		t.Errorf("uint32 decode fail: %d %v", v, err)
+	}
+	if v, err := DecodeFloat64(EncodeFloat64(-3.25)); err != nil || v != -3.25 {
+		t.Errorf("float64 decode fail: %f %v", v, err)
+	}
+	if v, err := DecodeFloat32(EncodeFloat32(1.5)); err != nil || v != 1.5 {
+		t.Errorf("float32 decode fail: %f %v", v, err)
+	}
+	if v, err := DecodeBool(EncodeBool(true)); err != nil || !v {
+		t.Errorf("bool decode fail: %v %v", v, err)
+	}
+	tm := time.Date(2009, 1, 1, 12, 0, 0, 500, time.UTC)
+	if v, err := DecodeTime(EncodeTime(tm)); err != nil || !v.Equal(tm) {
+		t.Errorf("time decode fail: %v %v", v, err)
+	}
+	if v, err := DecodeDesc(EncodeDesc([]byte("abc"))); err != nil || string(v) != "abc" {
+		t.Errorf("desc decode fail: %s %v", v, err)
+	}
+	for _, pair := range [][2]string{{"ab", "a"}, {"a\x00", "a"}, {"a\x00\x00", "a\x00"}, {"a\x01", "a\x00"}, {"b", "a\xff"}, {"\x00", ""}} {
+		if bytes.Compare(EncodeDesc([]byte(pair[0])), EncodeDesc([]byte(pair[1]))) >= 0 {
+			t.Errorf("desc order mismatch: %q should before %q", pair[0], pair[1])
+		}
+	}
+	for _, v := range []string{"", "\x00", "a\x00b", "\xff\x00\xff"} {
+		if d, err := DecodeDesc(EncodeDesc([]byte(v))); err != nil || string(d) != v {
+			t.Errorf("desc decode fail: %q %v", d, err)
+		}
+	}
+	for _, b := range [][]byte{{}, {0xFF}, {0x9e, 0xFF}, {0xFF, 0x01, 0xFF, 0xFF}, {0xFF, 0xFF, 0x9e}} {
+		if _, err := DecodeDesc(b); err == nil {
+			t.Errorf("invalid desc bytes should fail: %x", b)
+		}
+	}
+	if _, err := DecodeUint64([]byte{1, 2}); err == nil {
+		t.Errorf("decode short bytes should fail")
+	}
+
+	//encoded field should survive the index key escaping
+	v := int64(0x3a60) //contains 0x00, 0x3A and 0x60
+	keys := SplitIndexKey(MakeIndexKey(nil, EncodeInt64(v), EncodeString("a:b")))
+	if d, err := DecodeInt64(keys[0]); err != nil || d != v {
+		t.Errorf("split encoded key fail: %d %v", d, err)
+	}
+}
+
+func Test_indexKeyOrder(t *testing.T) {
+
+	pk := []byte{0, 0, 0, 0, 0, 0, 0, 1}
+	//every list is in ascending order, compare the whole index keys with a pk appended
+	cases := map[string][][][]byte{
+		"int64": {
+			{EncodeInt64(57)}, {EncodeInt64(58)}, {EncodeInt64(59)}, {EncodeInt64(60)}, {EncodeInt64(96)}, {EncodeInt64(256)},
+		},
+		"string": {
+			{EncodeString("")}, {EncodeString("A")}, {EncodeString("A B")}, {EncodeString("A:")}, {EncodeString("A`")},
+			{EncodeString("item1")}, {EncodeString("item10")}, {EncodeString("item2")},
+		},
+		"zero": {
+			{[]byte("a")}, {[]byte("a\x00")}, {[]byte("a\x00\x00")}, {[]byte("a\x00\x01")}, {[]byte("a\x01")}, {[]byte("a\xff")},
+		},
+		"union": {
+			{EncodeString("A"), EncodeInt64(60)}, {EncodeString("A"), []byte{0xFF}}, {EncodeString("A\x00"), EncodeInt64(0)},
+			{EncodeString("A "), EncodeInt64(-1)}, {EncodeString("A:"), EncodeInt64(58)}, {EncodeString("A:"), EncodeInt64(59)},
+		},
+	}
+
+	for name, values := range cases {
+		var prev []byte
+		for i := range values {
+			k := AppendLastKey(MakeIndexKey(nil, values[i][0], values[i][1:]...), pk)
+			if i > 0 && bytes.Compare(prev, k) >= 0 {
+				t.Errorf("%s index key order mismatch: %q should less than %q", name, values[i-1], values[i])
+			}
+			if fields := SplitIndexKey(k); len(fields) != len(values[i])+1 || !bytes.Equal(fields[len(fields)-1], pk) {
+				t.Errorf("%s split index key fail: %q", name, fields)
+			} else {
+				for j := range values[i] {
+					if !bytes.Equal(fields[j], values[i][j]) {
+						t.Errorf("%s split index key mismatch: %q %q", name, fields[j], values[i][j])
+					}
+				}
+			}
+			prev = k
+		}
+	}
+
+	//the bounds of the range scan
+	prefix := MakeIndexKey(nil, EncodeString("A"))
+	for _, v := range [][]byte{EncodeInt64(58), []byte("a\x00"), {}} {
+		lower, upper := lowerBound(prefix, v), upperBound(prefix, v)
+		for _, f := range [][]byte{v, append(bytes.Clone(v), 0), append(bytes.Clone(v), 0xFF)} {
+			k := AppendLastKey(MakeIndexKey(bytes.Clone(prefix), f), pk)
+			if bytes.Compare(k, lower) < 0 {
+				t.Errorf("key %q should not before the lower bound of %q", f, v)
+			}
+			if in := bytes.Compare(k, upper) < 0; in != bytes.Equal(f, v) {
+				t.Errorf("key %q upper bound of %q mismatch", f, v)
+			}
+		}
+	}
+}
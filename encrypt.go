@@ -0,0 +1,249 @@
+package kvt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+)
+
+// the header of an encrypted value is the header byte and the magic, followed by the key id length, key id,
+// nonce and the sealed value. a plaintext value is misread only if it starts with the header byte and the magic
+const headerEncrypt byte = 0xF0
+
+const encryptMagic = "kve"
+
+// position of the key id length
+const encryptIDPos = 1 + len(encryptMagic)
+
+const errKeyNotFound = "encryption key not found: [%s]"
+
+const errKeyIDInvalid = "encryption key id invalid: [%s], should be 1~255 bytes"
+
+const errValueNotEncrypted = "value not encrypted: %v, set Encryption.AllowPlain to read the records stored before encryption on"
+
+const errValueCorrupt = "encrypted value corrupt: %v"
+
+// give the AES keys(16, 24 or 32 bytes) by their id, the id is stored in every encrypted value
+type KeyProvider interface {
+	CurrentKey() (id string, key []byte, err error) //the key to encrypt the new values
+	Key(id string) ([]byte, error)                  //the key to decrypt a value, old keys should be kept until ReEncrypt finished
+}
+
+// a KeyProvider of the keys in memory
+type StaticKeys struct {
+	Current string            //id of the current key
+	Keys    map[string][]byte //(id, key)
+}
+
+func (s StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := s.Key(s.Current)
+	return s.Current, key, err
+}
+
+func (s StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := s.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf(errKeyNotFound, id)
+	}
+	return key, nil
+}
+
+// opt-in AES-GCM encryption of the values, set KVTParam.Encryption to turn it on.
+// it runs after compression, the pk is authenticated with the value, so a value can't be moved to another pk.
+// only the values of the data bucket are encrypted, the pks and index keys are stored in plaintext,
+// so don't index the personal data fields, and the covering indexs are rejected for their projections
+type Encryption struct {
+	Keys       KeyProvider
+	AllowPlain bool //read the values stored before encryption on, otherwise they are rejected
+}
+
+const errKeyProviderMissing = "encryption key provider missing"
+
+// the projection of a covering index is stored in the index value without encryption
+const errCoverEncrypted = "index is covering: [%s], its projection would be stored in plaintext with Encryption on"
+
+// the covering indexs would leak the encrypted fields by their projections
+func (kvt *KVT) checkCoverEncrypted() error {
+	if kvt.encryption == nil {
+		return nil
+	}
+	for name, index := range kvt.indexs {
+		if index.covering() {
+			return fmt.Errorf(errCoverEncrypted, name)
+		}
+	}
+	for name, mindex := range kvt.mindexs {
+		if mindex.covering() {
+			return fmt.Errorf(errCoverEncrypted, name)
+		}
+	}
+	return nil
+}
+
+// check the current key is usable
+func (kvt *KVT) saveEncryption(e *Encryption) error {
+	if e == nil {
+		return nil
+	}
+	if e.Keys == nil {
+		return fmt.Errorf(errKeyProviderMissing)
+	}
+	id, key, err := e.Keys.CurrentKey()
+	if err != nil {
+		return err
+	}
+	if len(id) == 0 || len(id) > 255 {
+		return fmt.Errorf(errKeyIDInvalid, id)
+	}
+	if _, err := newAEAD(key); err != nil {
+		return err
+	}
+	kvt.encryption = e
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// the additional data authenticated with the value, the header and the pk
+func encryptAD(header, pk []byte) []byte {
+	return append(append(make([]byte, 0, len(header)+len(pk)), header...), pk...)
+}
+
+// encrypt the value with the current key, if encryption is on
+func (kvt *KVT) encrypt(pk, value []byte) ([]byte, error) {
+	if kvt.encryption == nil {
+		return value, nil
+	}
+	id, key, err := kvt.encryption.Keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) == 0 || len(id) > 255 {
+		return nil, fmt.Errorf(errKeyIDInvalid, id)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append(append([]byte{headerEncrypt}, encryptMagic...), byte(len(id)))
+	header = append(header, id...)
+	out := make([]byte, 0, len(header)+aead.NonceSize()+len(value)+aead.Overhead())
+	out = append(out, header...)
+	nonce := out[len(out) : len(out)+aead.NonceSize()]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = out[:len(out)+len(nonce)]
+	return aead.Seal(out, nonce, value, encryptAD(header, pk)), nil
+}
+
+// decrypt the stored value with the key of its id, if encryption is on
+func (kvt *KVT) decrypt(pk, stored []byte) ([]byte, error) {
+	if kvt.encryption == nil {
+		return stored, nil
+	}
+	if !encrypted(stored) {
+		if kvt.encryption.AllowPlain {
+			return stored, nil
+		}
+		return nil, fmt.Errorf(errValueNotEncrypted, pk)
+	}
+	if len(stored) < encryptIDPos+1+int(stored[encryptIDPos]) {
+		return nil, fmt.Errorf(errValueCorrupt, pk)
+	}
+	header := stored[:encryptIDPos+1+int(stored[encryptIDPos])]
+	key, err := kvt.encryption.Keys.Key(string(header[encryptIDPos+1:]))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed := stored[len(header):]
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf(errValueCorrupt, pk)
+	}
+	value, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], encryptAD(header, pk))
+	if err != nil {
+		return nil, fmt.Errorf(errValueCorrupt, pk)
+	}
+	return value, nil
+}
+
+// true if the stored value has the header of encrypt
+func encrypted(stored []byte) bool {
+	return len(stored) > encryptIDPos && stored[0] == headerEncrypt && string(stored[1:encryptIDPos]) == encryptMagic
+}
+
+// the key id of an encrypted value, empty if it's not encrypted
+func encryptKeyID(stored []byte) string {
+	if !encrypted(stored) || len(stored) < encryptIDPos+1+int(stored[encryptIDPos]) {
+		return ""
+	}
+	return string(stored[encryptIDPos+1 : encryptIDPos+1+int(stored[encryptIDPos])])
+}
+
+// re-encrypt params, run it in several transactions with After = last returned pk for a large table
+type ReEncryptInfo struct {
+	After    []byte       //resume after this primary key, nil means from the beginning
+	Limit    int          //max records rewritten in one call, 0 means no limit
+	Progress ProgressFunc //optional
+}
+
+// rewrite part of the data bucket with the current key and compression, the index buckets are not changed,
+// the records already encrypted by the current key are skipped.
+// return the last pk to resume with, nil if all finished
+func (kvt *KVT) ReEncryptChunk(db Poler, info ReEncryptInfo) (last []byte, err error) {
+	current := ""
+	if kvt.encryption != nil {
+		if current, _, err = kvt.encryption.Keys.CurrentKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	kvs, more, err := kvt.scanChunk(db, info.After, info.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	total := len(kvs)
+	for i := 0; i < total; i++ {
+		pk := kvs[i].Key
+		if current == "" || encryptKeyID(kvs[i].Value) != current {
+			value, err := kvt.unpack(pk, kvs[i].Value)
+			if err != nil {
+				return last, err
+			}
+			if value, err = kvt.pack(pk, value); err != nil {
+				return last, err
+			}
+			if err := db.Put(kvt.path, pk, value); err != nil {
+				return last, err
+			}
+		}
+		last = pk
+		if info.Progress != nil {
+			info.Progress(i+1, total)
+		}
+	}
+
+	if !more { //all finished
+		return nil, nil
+	}
+	return last, nil
+}
+
+// rewrite all the records of the data bucket with the current key in one transaction
+func (kvt *KVT) ReEncrypt(db Poler) error {
+	_, err := kvt.ReEncryptChunk(db, ReEncryptInfo{})
+	return err
+}
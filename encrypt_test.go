@@ -0,0 +1,128 @@
+package kvt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncrypt(t *testing.T) {
+	keys := StaticKeys{Current: "k1", Keys: map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 16),
+	}}
+	k, err := New(note{}, &KVTParam{Bucket: "Bucket_note", Encryption: &Encryption{Keys: keys}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := []byte("personal data")
+	sealed, err := k.encrypt([]byte("pk1"), value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, value) || encryptKeyID(sealed) != "k1" {
+		t.Errorf("value should be encrypted by k1: %x", sealed)
+	}
+	if again, _ := k.encrypt([]byte("pk1"), value); bytes.Equal(again, sealed) {
+		t.Errorf("every encryption should use a new nonce")
+	}
+	if v, err := k.decrypt([]byte("pk1"), sealed); err != nil || !bytes.Equal(v, value) {
+		t.Errorf("decrypt mismatch: %q %v", v, err)
+	}
+
+	//the pk and the header are authenticated
+	if _, err := k.decrypt([]byte("pk2"), sealed); err == nil {
+		t.Errorf("a value moved to another pk should fail")
+	}
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := k.decrypt([]byte("pk1"), tampered); err == nil {
+		t.Errorf("a tampered value should fail")
+	}
+	for i := range sealed {
+		if _, err := k.decrypt([]byte("pk1"), sealed[:i]); err == nil {
+			t.Errorf("a truncated value at %d should fail", i)
+		}
+	}
+
+	//rotate to k2, the values of k1 are still readable
+	keys.Current = "k2"
+	rotated, _ := New(note{}, &KVTParam{Bucket: "Bucket_note", Encryption: &Encryption{Keys: keys}})
+	if sealed2, _ := rotated.encrypt([]byte("pk1"), value); encryptKeyID(sealed2) != "k2" {
+		t.Errorf("new values should use the current key k2")
+	}
+	if v, err := rotated.decrypt([]byte("pk1"), sealed); err != nil || !bytes.Equal(v, value) {
+		t.Errorf("old key should decrypt: %v", err)
+	}
+	delete(keys.Keys, "k1")
+	if _, err := rotated.decrypt([]byte("pk1"), sealed); err == nil {
+		t.Errorf("removed key should fail")
+	}
+
+	//plain values are rejected unless AllowPlain
+	if _, err := k.decrypt([]byte("pk1"), value); err == nil {
+		t.Errorf("plain value should be rejected")
+	}
+	k.encryption.AllowPlain = true
+	if v, err := k.decrypt([]byte("pk1"), value); err != nil || !bytes.Equal(v, value) {
+		t.Errorf("plain value should be allowed: %v", err)
+	}
+	//a plain value starts with the header byte but without the magic
+	for _, plain := range [][]byte{{headerEncrypt}, {headerEncrypt, 0x02, 'k', '1'}, append([]byte{headerEncrypt}, "kv"...)} {
+		if v, err := k.decrypt([]byte("pk1"), plain); err != nil || !bytes.Equal(v, plain) || encryptKeyID(plain) != "" {
+			t.Errorf("plain value with the header byte should be allowed: %x %v", plain, err)
+		}
+	}
+	if _, err := k.decrypt([]byte("pk1"), append(append([]byte{headerEncrypt}, encryptMagic...), 5)); err == nil {
+		t.Errorf("encrypted value without the key id should be corrupt")
+	}
+
+	for _, e := range []*Encryption{
+		{},
+		{Keys: StaticKeys{Current: "k3", Keys: keys.Keys}},
+		{Keys: StaticKeys{Current: "bad", Keys: map[string][]byte{"bad": {1, 2, 3}}}},
+		{Keys: StaticKeys{Current: "", Keys: map[string][]byte{"": make([]byte, 16)}}},
+	} {
+		if _, err := New(note{}, &KVTParam{Bucket: "Bucket_note", Encryption: e}); err == nil {
+			t.Errorf("invalid encryption should fail: %+v", e)
+		}
+	}
+
+	//the projections of covering indexs would be stored in plaintext
+	for _, kp := range []KVTParam{
+		{Indexs: []IndexInfo{{Name: "idx_ID", Cover: []string{"Title"}}}},
+		{MIndexs: []MIndex{{IndexInfo: &IndexInfo{Name: "midx_Refs", Project: func(any) ([]byte, error) { return nil, nil }}}}},
+	} {
+		kp.Bucket, kp.Encryption = "Bucket_note", &Encryption{Keys: keys}
+		if _, err := New(note{}, &kp); err == nil {
+			t.Errorf("covering index with encryption should fail: %+v", kp)
+		}
+		kp.Encryption = nil
+		if _, err := New(note{}, &kp); err != nil {
+			t.Errorf("covering index without encryption fail: %s", err)
+		}
+	}
+}
+
+func TestPackOrder(t *testing.T) {
+	//compressed first, the ciphertext doesn't compress
+	k, err := New(note{}, &KVTParam{
+		Bucket:      "Bucket_note",
+		Compression: &Compression{Compressor: FlateCompressor{}},
+		Encryption:  &Encryption{Keys: StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": make([]byte, 32)}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := bytes.Repeat([]byte("abcd"), 200)
+	stored, err := k.pack([]byte("pk"), value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) >= len(value)/2 {
+		t.Errorf("value should be compressed before encrypted: %d", len(stored))
+	}
+	if v, err := k.unpack([]byte("pk"), stored); err != nil || !bytes.Equal(v, value) {
+		t.Errorf("unpack mismatch: %v", err)
+	}
+}
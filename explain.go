@@ -0,0 +1,79 @@
+package kvt
+
+import (
+	"fmt"
+)
+
+// the cost of a range query, set RangeInfo.Stats to collect it
+type QueryStats struct {
+	Scanned  int //index keys scanned
+	Filtered int //index keys scanned but filtered out by the left fields
+	Fetched  int //records read from the data bucket
+}
+
+// nil stats counts nothing
+func (s *QueryStats) count(scanned, filtered, fetched int) {
+	if s == nil {
+		return
+	}
+	s.Scanned += scanned
+	s.Filtered += filtered
+	s.Fetched += fetched
+}
+
+// how a range query runs on the index, Run it to fill the Stats
+type QueryExplain struct {
+	IndexName    string
+	Prefix       [][]byte   //field values in the scan prefix, split from the prefix bytes
+	PrefixFields []string   //leading fields given by equality, pushed into the prefix
+	FilterFields []string   //fields compared on every scanned index key
+	Scans        int        //prefix scans, IN on the prefix fields makes one scan for every value
+	Bounded      bool       //the first field after the prefix narrows the scan by a start/end bound
+	Stats        QueryStats //filled by Run
+
+	kvt       *KVT
+	rangeInfo RangeInfo
+}
+
+func (e *QueryExplain) String() string {
+	return fmt.Sprintf("index %s, prefix %v %q, filter %v, scans %d, bounded %t, scanned %d, filtered %d, fetched %d",
+		e.IndexName, e.PrefixFields, e.Prefix, e.FilterFields, e.Scans, e.Bounded,
+		e.Stats.Scanned, e.Stats.Filtered, e.Stats.Fetched)
+}
+
+// explain the range query without running it
+func (kvt *KVT) Explain(rangeInfo RangeInfo) (*QueryExplain, error) {
+
+	plan, err := kvt.makeQueryPlan(rangeInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &QueryExplain{
+		IndexName:    rangeInfo.IndexName,
+		PrefixFields: plan.prefixFields,
+		FilterFields: plan.filterFields,
+		Scans:        len(plan.ranges),
+		kvt:          kvt,
+		rangeInfo:    rangeInfo,
+	}
+	for _, r := range plan.ranges {
+		e.Bounded = e.Bounded || r.start != nil || r.end != nil
+	}
+	//the first scan's prefix if there are several
+	if prefix := plan.ranges[0].prefix; len(prefix) > 0 {
+		values := SplitIndexKey(prefix)
+		for i := range values {
+			e.Prefix = append(e.Prefix, plan.index.fieldValue(i, values[i]))
+		}
+	}
+	return e, nil
+}
+
+// run the explained range query, and count its cost into Stats
+func (e *QueryExplain) Run(db Poler) ([]any, error) {
+	e.Stats = QueryStats{}
+	rangeInfo := e.rangeInfo
+	rangeInfo.Stats = &e.Stats
+	return e.kvt.RangeQuery(db, rangeInfo)
+}
@@ -0,0 +1,246 @@
+package kvt
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// the plan Find used to answer the where conditions
+type FindPlan struct {
+	IndexName string   //the index or mindex chosen, empty means a full data bucket scan
+	Equals    []string //leading index fields given by equality, they make up the scan prefix
+	Range     string   //the index field after Equals with a range condition, empty if none
+	Filters   []string //where fields not in the index, checked on every fetched obj
+}
+
+// true if no index fits the where conditions
+func (p *FindPlan) FullScan() bool {
+	return p.IndexName == ""
+}
+
+func (p *FindPlan) String() string {
+	if p.FullScan() {
+		return fmt.Sprintf("full scan, filter %v", p.Filters)
+	}
+	return fmt.Sprintf("index %s, prefix %v, range [%s], filter %v", p.IndexName, p.Equals, p.Range, p.Filters)
+}
+
+// how well an index fits the where, compare equals first, then range, covered fields, and fewer index fields
+type findScore struct {
+	equals  int
+	ranged  int
+	covered int
+	fields  int
+}
+
+func (s findScore) better(o findScore) bool {
+	switch {
+	case s.equals != o.equals:
+		return s.equals > o.equals
+	case s.ranged != o.ranged:
+		return s.ranged > o.ranged
+	case s.covered != o.covered:
+		return s.covered > o.covered
+	}
+	return s.fields < o.fields
+}
+
+func hasEqualOp(ops map[string][]byte) bool {
+	for op, v := range ops {
+		switch cmpOperator(op) {
+		case "=", "==", "in":
+			if len(v) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// the plan and score of the where conditions on an index
+func planIndex(index *IndexInfo, where map[string]map[string][]byte, fields []string) (*FindPlan, findScore) {
+	plan := &FindPlan{IndexName: index.Name}
+	score := findScore{fields: len(index.Fields)}
+	for _, name := range index.Fields {
+		ops, ok := where[name]
+		if !ok {
+			break
+		}
+		if hasEqualOp(ops) {
+			plan.Equals = append(plan.Equals, name)
+			continue
+		}
+		plan.Range = name
+		score.ranged = 1
+		break
+	}
+	score.equals = len(plan.Equals)
+	for _, name := range fields {
+		if slices.Contains(index.Fields, name) {
+			score.covered++
+		} else {
+			plan.Filters = append(plan.Filters, name)
+		}
+	}
+	return plan, score
+}
+
+// true if the index keys are generated from the fields by the Encode* functions, the same as matchFields,
+// a hand-written Index() or MIndexFunc may encode the fields another way
+func (kvt *KVT) fieldsEncoded(name string) bool {
+	if mindex, ok := kvt.mindexs[name]; ok {
+		return mindex.Key == nil
+	}
+	return kvt.indexs[name].auto || (!kvt.typ.Implements(indexerType) && !reflect.PointerTo(kvt.typ).Implements(indexerType))
+}
+
+// choose the index for the where conditions, the one with the longest equality prefix followed by a range field,
+// partial indexs and the indexs not generated from the fields are never chosen, a full data bucket scan if no index fits,
+// so the where values should be encoded by the Encode* functions, and the result is the same whatever plan is chosen
+func (kvt *KVT) PlanFind(where map[string]map[string][]byte) (*FindPlan, error) {
+	fields := make([]string, 0, len(where))
+	for name, ops := range where {
+		for op := range ops {
+			if _, ok := kvt.compareFunc(name, op); !ok {
+				return nil, fmt.Errorf(errCompareOperatorInvalid, op)
+			}
+		}
+		fields = append(fields, name)
+	}
+	slices.Sort(fields)
+
+	best := &FindPlan{Filters: fields}
+	var bestScore findScore
+	names := kvt.allIndexNames()
+	slices.Sort(names)
+	for _, name := range names {
+		index, _ := kvt.getIndexInfo(name)
+		if index.Partial != nil || !kvt.fieldsEncoded(name) {
+			continue
+		}
+		plan, score := planIndex(index, where, fields)
+		if score.equals+score.ranged == 0 {
+			continue
+		}
+		if best.FullScan() || score.better(bestScore) {
+			best, bestScore = plan, score
+		}
+	}
+	return best, nil
+}
+
+// check the obj fields with the where conditions, a slice field matches if any element matches,
+// the values compared are encoded by the Encode* functions, like the auto generated index keys
+func (kvt *KVT) matchFields(obj KVer, where map[string]map[string][]byte, fields []string) (bool, error) {
+	v := structValue(obj)
+	for _, name := range fields {
+		fv := v.FieldByName(name)
+		if !fv.IsValid() {
+			return false, fmt.Errorf(errIndexFieldMismatch, name)
+		}
+		values, err := encodeMultiReflect(fv)
+		if err != nil {
+			return false, err
+		}
+		collate := kvt.fields[name].Collate
+		matched := false
+		for _, d := range values {
+			if collate != nil {
+				d = collate(d)
+			}
+			matched = true
+			for op, cv := range where[name] {
+				cmp, _ := kvt.compareFunc(name, op)
+				if !cmp(d, collateWhere(collate, cmpOperator(op), cv)) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// query the objs matched by the where conditions without naming an index, (fieldName, (operator, value)),
+// return the plan it used, see PlanFind
+func (kvt *KVT) Find(db Poler, where map[string]map[string][]byte) (result []any, plan *FindPlan, err error) {
+
+	plan, err = kvt.PlanFind(where)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var matchErr error
+	if plan.FullScan() {
+		err = db.Scan(kvt.path, ScanInfo{}, func(k, v []byte) bool {
+			obj, err := kvt.tryLoad(k[kvt.offset:], v)
+			if err != nil {
+				matchErr = err
+				return false
+			}
+			if obj == nil {
+				return true
+			}
+			ok, err := kvt.matchFields(obj, where, plan.Filters)
+			if err != nil {
+				matchErr = err
+				return false
+			}
+			if ok {
+				result = append(result, obj)
+			}
+			return true
+		})
+		if err == nil {
+			err = matchErr
+		}
+		return result, plan, err
+	}
+
+	index, _ := kvt.getIndexInfo(plan.IndexName)
+	rangeInfo := RangeInfo{IndexName: plan.IndexName, Where: make(map[string]map[string][]byte, len(where))}
+	for name, ops := range where {
+		if slices.Contains(index.Fields, name) {
+			rangeInfo.Where[name] = ops
+		}
+	}
+	pks, err := kvt.RangeQueryKeys(db, rangeInfo)
+	if err != nil {
+		return nil, plan, err
+	}
+
+	seen := make(map[string]struct{}, len(pks)) //mindex may hit an obj several times
+	for i := range pks {
+		if _, ok := seen[string(pks[i])]; ok {
+			continue
+		}
+		seen[string(pks[i])] = struct{}{}
+
+		v, err := db.Get(kvt.path, pks[i])
+		if err != nil {
+			return result, plan, err
+		}
+		obj, err := kvt.tryLoad(pks[i], v)
+		if err != nil {
+			return result, plan, err
+		}
+		if obj == nil {
+			continue
+		}
+		ok, err := kvt.matchFields(obj, where, plan.Filters)
+		if err != nil {
+			return result, plan, err
+		}
+		if ok {
+			result = append(result, obj)
+		}
+	}
+	return result, plan, nil
+}
@@ -2,14 +2,16 @@ module github.com/simpleKV/kvt
 
 go 1.22.2
 
-require go.etcd.io/bbolt v1.3.11
+require (
+	github.com/redis/go-redis/v9 v9.6.1
+	github.com/tidwall/buntdb v1.3.1
+	go.etcd.io/bbolt v1.3.11
+)
 
 require (
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
-	github.com/redis/go-redis/v9 v9.6.1 // indirect
 	github.com/tidwall/btree v1.4.2 // indirect
-	github.com/tidwall/buntdb v1.3.1 // indirect
 	github.com/tidwall/gjson v1.14.3 // indirect
 	github.com/tidwall/grect v0.1.4 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
@@ -0,0 +1,63 @@
+//go:build go1.23
+
+package kvt
+
+import "iter"
+
+// range over func variant of Iterate, the error(if any) is yielded at last with a nil obj
+func (kvt *KVT) RangeSeq(db Poler, rangeInfo RangeInfo) iter.Seq2[KVer, error] {
+	return func(yield func(KVer, error) bool) {
+		stopped := false
+		err := kvt.Iterate(db, rangeInfo, func(obj KVer) bool {
+			stopped = !yield(obj, nil)
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield(nil, err)
+		}
+	}
+}
+
+// range over func variant of IterateGets
+func (kvt *KVT) GetsSeq(db Poler, prefix []byte) iter.Seq2[KVer, error] {
+	return func(yield func(KVer, error) bool) {
+		stopped := false
+		err := kvt.IterateGets(db, prefix, func(obj KVer) bool {
+			stopped = !yield(obj, nil)
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield(nil, err)
+		}
+	}
+}
+
+// typed variant of RangeSeq
+func (t *Table[T]) RangeSeq(db Poler, rangeInfo RangeInfo) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		stopped := false
+		err := t.Iterate(db, rangeInfo, func(obj T) bool {
+			stopped = !yield(obj, nil)
+			return !stopped
+		})
+		if err != nil && !stopped {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
+
+// typed variant of GetsSeq
+func (t *Table[T]) GetsSeq(db Poler, prefix []byte) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		stopped := false
+		err := t.IterateGets(db, prefix, func(obj T) bool {
+			stopped = !yield(obj, nil)
+			return !stopped
+		})
+		if err != nil && !stopped {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
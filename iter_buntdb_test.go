@@ -0,0 +1,130 @@
+//go:build buntdb && go1.23
+// +build buntdb,go1.23
+
+package kvt
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+)
+
+// the iter.Seq2 APIs need go1.23, test them apart
+func Test_rangeSeq(t *testing.T) {
+
+	os.Remove("query_test.bdb")
+	bdb, err := buntdb.Open("query_test.bdb")
+	if err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	kp := KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_Level_Score", Fields: []string{"Level", "Score"}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	bdb.Update(func(tx *buntdb.Tx) error {
+		p, _ := NewPoler(tx)
+		k.CreateDataBucket(p)
+		k.SetSequence(p, 1000)
+		k.CreateIndexBuckets(p)
+		return nil
+	})
+
+	ms := make([]member, 10)
+	bdb.Update(func(tx *buntdb.Tx) error {
+		p, _ := NewPoler(tx)
+		for i := range ms {
+			ms[i].ID, _ = k.NextSequence(p)
+			ms[i].Email = fmt.Sprintf("%d@a.com", i)
+			ms[i].Level = 1 + i%2
+			ms[i].Score = float64(i)
+			k.Put(p, &ms[i])
+		}
+		return nil
+	})
+
+	bdb.View(func(tx *buntdb.Tx) error {
+		p, _ := NewPoler(tx)
+
+		ids := make([]uint64, 0)
+		k.RangeSeq(p, RangeInfo{
+			IndexName: "idx_Level_Score",
+			Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(2)}},
+			Reverse:   true,
+		})(func(obj KVer, err error) bool {
+			if err != nil {
+				t.Errorf("range seq fail: %s", err)
+				return false
+			}
+			ids = append(ids, obj.(*member).ID)
+			return len(ids) < 2
+		})
+		if !reflect.DeepEqual(ids, []uint64{ms[9].ID, ms[7].ID}) {
+			t.Errorf("range seq mismatch: %v", ids)
+		}
+
+		n := 0
+		k.GetsSeq(p, nil)(func(obj KVer, err error) bool {
+			n++
+			return err == nil
+		})
+		if n != len(ms) {
+			t.Errorf("gets seq mismatch: %d", n)
+		}
+
+		k.RangeSeq(p, RangeInfo{IndexName: "idx_Unknown"})(func(obj KVer, err error) bool {
+			if err == nil || obj != nil {
+				t.Errorf("range seq should yield the error")
+			}
+			return true
+		})
+
+		//the typed seqs of a Table
+		tb, err := NewTable[*member](&kp, nil)
+		if err != nil {
+			t.Errorf("new table fail: %s", err)
+			return nil
+		}
+		tb.KVT().CreateDataBucket(p)
+		tb.KVT().CreateIndexBuckets(p)
+		ids = ids[:0]
+		tb.RangeSeq(p, RangeInfo{
+			IndexName: "idx_Level_Score",
+			Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(1)}},
+		})(func(m *member, err error) bool {
+			if err != nil {
+				t.Errorf("table range seq fail: %s", err)
+				return false
+			}
+			ids = append(ids, m.ID)
+			return true
+		})
+		if !reflect.DeepEqual(ids, []uint64{ms[0].ID, ms[2].ID, ms[4].ID, ms[6].ID, ms[8].ID}) {
+			t.Errorf("table range seq mismatch: %v", ids)
+		}
+		n = 0
+		for m, err := range tb.GetsSeq(p, nil) {
+			if err != nil || m.Email != ms[n].Email {
+				t.Errorf("table gets seq mismatch: %v %v", m, err)
+			}
+			n++
+		}
+		if n != len(ms) {
+			t.Errorf("table gets seq mismatch: %d", n)
+		}
+		return nil
+	})
+}
@@ -4,13 +4,19 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 )
 
 type DecodeFunc = func([]byte, KVer) (KVer, error)
 type CompareFunc = func(d, v []byte) bool
 type FilterFunc = func(k []byte) bool
+type ScanFunc = func(k, v []byte) bool        //return false to stop the scan
+type IterFunc = func(obj KVer) bool           //return false to stop the iteration
 type MIndexFunc = func(any) ([][]byte, error) //a index func return multi value
+type ProjectFunc = func(any) ([]byte, error)  //a covering index func return the projection of obj
+type PartialFunc = func(any) bool             //a partial index only index the obj when it return true
+type CollateFunc = func(v []byte) []byte      //convert a field value to its sort key
 
 // 2 index type index, mindex
 const IDXPrefix = "idx_"   //index name prefix
@@ -18,8 +24,13 @@ const MIDXPrefix = "midx_" //mindex return multi index value from one field, it
 
 const defaultPathJoiner = '/'
 const defaultIDXJoiner = '_'
-const defaultKeyJoiner = ':' //field1:field2,  escape ':' with "`"
-const defaultKeyEscaper = '`'
+const defaultKeyJoiner = ':' //buntdb joins the bucket path and the key with it
+
+// index key fields end with 0x00 0x01, 0x00 in a field is escaped as 0x00 0xFF,
+// so the index keys sort as their fields, a field sorts before the longer ones it prefixes
+const keyEscaper = 0x00
+const keyEscaped = 0xFF
+const keyTerminator = 0x01
 const sequenceName = "__sequence__"
 
 const errIndexNameInvalid = "index name invalid: [%s], should like as /path/to/idx_Name"
@@ -34,43 +45,86 @@ const errBucketOpenFailed = "bucket [%s] not found or open failed"
 
 const errCompareOperatorInvalid = "compare operator [%s] is invalid"
 
+const errCursorInvalid = "cursor invalid: [%s]"
+
 const errNewPolerFailed = "new poler failed, invalid db handler"
 
+// a unique index value has been owned by another primary key
+const errUniqueConflict = "unique index conflict: [%s], value already owned by key %v"
+
+// unique lookup need an unique index and all its fields
+const errIndexNotUnique = "index is not unique: [%s]"
+
+// a partial index misses the objs its predicate skipped, query it only when the caller accepts that
+const errIndexPartial = "index is partial: [%s], set Partial to query the objs it covers only"
+
 // next 2 errors is common, export to users
 const ErrIndexNotFound = "index not found: [%s]"
 const ErrDataNotFound = "data not found"
 
+// implement Indexer too if you want generate the index key by hand
+// an obj stored by KVT, its value is from Value() if it's a Valuer, otherwise from the Codec
 type KVer interface {
 	Key() ([]byte, error)
-	Value() ([]byte, error)
-	Index(string) ([]byte, error)
 }
 
 type KVT struct {
-	bucket    string //bucket or table name
-	path      string //its parent path
-	unmarshal DecodeFunc
-	indexs    map[string]*IndexInfo //(indexName, *IDX)
-	mindexs   map[string]MIndex
+	bucket      string //bucket or table name
+	path        string //its parent path
+	offset      int    //data bucket key prefix offset, for the db which doesn't support bucket
+	unmarshal   DecodeFunc
+	codec       Codec
+	compression *Compression
+	compressors map[byte]Compressor //(header byte, compressor)
+	encryption  *Encryption
+	indexs      map[string]*IndexInfo //(indexName, *IDX)
+	mindexs     map[string]MIndex
+	operators   map[string]CompareFunc //custom compare operators
+	fields      map[string]FieldInfo   //(fieldName, collation and operators)
+	typ         reflect.Type           //struct type of the obj, to encode the literals of a text query
 }
 
 type IndexInfo struct {
-	Name   string   //index name like "idx_field1_field2"
-	Fields []string //["field1", "field2"...]
-	path   string   //full paraent path to index, eg   "root/to/Bucket"
-	offset int      //some kv db doesn't support bucket, so add bucket name in the key, it's a bucket prefix offset
+	Name    string        //index name like "idx_field1_field2"
+	Fields  []string      //["field1", "field2"...]
+	Unique  bool          //one index value can only point to one primary key
+	Desc    []string      //fields stored in descending order, others are ascending
+	Cover   []string      //fields stored in the index value, query them without reading the data bucket
+	Project ProjectFunc   //custom projection stored in the index value, instead of Cover
+	Partial PartialFunc   //index the objs it returns true only, nil means all objs
+	auto    bool          //declared by struct tag, always generated from the fields
+	path    string        //full paraent path to index, eg   "root/to/Bucket"
+	offset  int           //some kv db doesn't support bucket, so add bucket name in the key, it's a bucket prefix offset
+	desc    []bool        //descending flag of every field
+	collate []CollateFunc //collation of every field, nil means raw bytes
 }
 
 type MIndex struct {
 	*IndexInfo
-	Key MIndexFunc //generate index multi key, value is the pk
+	Key MIndexFunc //generate index multi key, value is the pk, nil means generate from the fields
+}
+
+// Put returns it when an unique index value belongs to another primary key
+type UniqueError struct {
+	Index string //the unique index name
+	Value []byte //the conflict index value, without the pk suffix
+	Key   []byte //primary key which already owns the value
+}
+
+func (e *UniqueError) Error() string {
+	return fmt.Sprintf(errUniqueConflict, e.Index, e.Key)
 }
 
 type KVTParam struct {
-	Bucket    string      //bucket (with its paraent if exists), eg: "root/path/to/your/Bucket"
-	Unmarshal DecodeFunc  //unmarshal value bytes to a object
-	Indexs    []IndexInfo //generate idx bucket's key
-	MIndexs   []MIndex
+	Bucket      string       //bucket (with its paraent if exists), eg: "root/path/to/your/Bucket"
+	Unmarshal   DecodeFunc   //unmarshal value bytes to a object, nil means decode by the Codec
+	Codec       Codec        //marshal the objs without Value() and unmarshal when no Unmarshal func, nil means GobCodec
+	Compression *Compression //compress the values before stored, nil means off
+	Encryption  *Encryption  //encrypt the values before stored, after compression, nil means off
+	Indexs      []IndexInfo  //generate idx bucket's key
+	MIndexs     []MIndex
+	Operators   map[string]CompareFunc //custom compare operators for all fields
+	Fields      map[string]FieldInfo   //collation and operators of a field, for all the indexs on it
 }
 
 func parse(obj any) map[string]struct{} {
@@ -101,11 +155,17 @@ func splitPath(fullPath string) (string, []string, error) {
 	}
 }
 
-func makeIndexInfo(name string, fields, p []string) *IndexInfo {
+func makeIndexInfo(name string, src *IndexInfo, p []string) *IndexInfo {
 	idx := &IndexInfo{
-		Name: name,
+		Name:    name,
+		Unique:  src.Unique,
+		Project: src.Project,
+		Partial: src.Partial,
+		auto:    src.auto,
 	}
-	idx.Fields = append(idx.Fields, fields...)
+	idx.Fields = append(idx.Fields, src.Fields...)
+	idx.Desc = append(idx.Desc, src.Desc...)
+	idx.Cover = append(idx.Cover, src.Cover...)
 	idx.path = strings.Join(p, string(defaultPathJoiner))
 
 	if len(idx.Fields) == 0 {
@@ -118,9 +178,74 @@ func makeIndexInfo(name string, fields, p []string) *IndexInfo {
 		}
 	}
 
+	idx.desc = make([]bool, len(idx.Fields))
+	for i := range idx.Fields {
+		for j := range idx.Desc {
+			if idx.Fields[i] == idx.Desc[j] {
+				idx.desc[i] = true
+			}
+		}
+	}
+
 	return idx
 }
 
+// true if the obj should have entries in the index, always true except a partial index
+func (idx *IndexInfo) indexed(obj KVer) bool {
+	return idx.Partial == nil || idx.Partial(obj)
+}
+
+// true if any field of the index is descending
+func (idx *IndexInfo) hasDesc() bool {
+	return len(idx.Desc) > 0
+}
+
+// collation of the field, nil means raw bytes
+func (idx *IndexInfo) collateAt(i int) CollateFunc {
+	if i < len(idx.collate) {
+		return idx.collate[i]
+	}
+	return nil
+}
+
+// convert a field value to its stored bytes, collate it and invert it if the field is descending
+func (idx *IndexInfo) fieldKey(i int, v []byte) []byte {
+	if collate := idx.collateAt(i); collate != nil {
+		v = collate(v)
+	}
+	return idx.directValue(i, v)
+}
+
+// invert the collated value if the field is descending
+func (idx *IndexInfo) directValue(i int, v []byte) []byte {
+	if i < len(idx.desc) && idx.desc[i] {
+		return EncodeDesc(v)
+	}
+	return v
+}
+
+// convert the stored bytes back to the field value, collated value if the field has a collation
+func (idx *IndexInfo) fieldValue(i int, v []byte) []byte {
+	if i < len(idx.desc) && idx.desc[i] {
+		d, _ := DecodeDesc(v)
+		return d
+	}
+	return v
+}
+
+// rewrite the ascending index key with the field collations and directions
+func (idx *IndexInfo) directKey(ik []byte) []byte {
+	if (!idx.hasDesc() && idx.collate == nil) || len(ik) == 0 {
+		return ik
+	}
+	fields := SplitIndexKey(ik)
+	key := make([]byte, 0, len(ik)+len(fields))
+	for i := range fields {
+		key = MakeIndexKey(key, idx.fieldKey(i, fields[i]))
+	}
+	return key
+}
+
 // user give us the full path name, need split into []
 func (kvt *KVT) saveIndexs(kp *KVTParam) error {
 	//the main bucket
@@ -145,9 +270,9 @@ func (kvt *KVT) saveIndexs(kp *KVTParam) error {
 		var p []string
 		//here we add prefix main bucket name as idx path
 		//for a idx like "idx_Type" is very possible conflict
-		//with another objects's "idx_Type"
+		//with another objects's "idx_Type", the tag declared too
 		if (len(path) > 0 && path[0] == kvt.bucket) ||
-			len(path) == 0 && len(kp.Indexs[i].Fields) == 0 {
+			len(path) == 0 && (len(kp.Indexs[i].Fields) == 0 || kp.Indexs[i].auto) {
 			p = append(p, mainPath...)
 			if len(path) == 0 {
 				p = append(p, kvt.bucket)
@@ -155,7 +280,7 @@ func (kvt *KVT) saveIndexs(kp *KVTParam) error {
 		}
 		p = append(p, path...)
 		p = append(p, name)
-		kvt.indexs[name] = makeIndexInfo(name, kp.Indexs[i].Fields, p)
+		kvt.indexs[name] = makeIndexInfo(name, &kp.Indexs[i], p)
 	}
 
 	//mindexs
@@ -171,10 +296,13 @@ func (kvt *KVT) saveIndexs(kp *KVTParam) error {
 		var p []string
 		if len(path) > 0 && path[0] == kvt.bucket { //index nested in data bucket
 			p = append(p, mainPath...)
+		} else if len(path) == 0 && kp.MIndexs[i].auto { //tag declared, nested in data bucket
+			p = append(p, mainPath...)
+			p = append(p, kvt.bucket)
 		}
 		p = append(p, path...) //index path
 		p = append(p, name)    //index bucket
-		kvt.mindexs[name] = MIndex{makeIndexInfo(name, kp.MIndexs[i].Fields, p), kp.MIndexs[i].Key}
+		kvt.mindexs[name] = MIndex{makeIndexInfo(name, kp.MIndexs[i].IndexInfo, p), kp.MIndexs[i].Key}
 	}
 
 	return nil
@@ -190,6 +318,17 @@ func checkIndexFields(index *IndexInfo, allFields map[string]struct{}) error {
 			return fmt.Errorf(errIndexFieldMismatch, index.Name)
 		}
 	}
+	//descending field should be one of the index fields
+	for _, v := range index.Desc {
+		if !slices.Contains(index.Fields, v) {
+			return fmt.Errorf(errIndexFieldMismatch, index.Name)
+		}
+	}
+	for _, v := range index.Cover {
+		if _, ok := allFields[v]; !ok {
+			return fmt.Errorf(errIndexFieldMismatch, index.Name)
+		}
+	}
 	return nil
 }
 
@@ -215,9 +354,37 @@ func New(obj any, kp *KVTParam) (kvt *KVT, err error) {
 	kvt = &KVT{
 		bucket:    kp.Bucket,
 		unmarshal: kp.Unmarshal,
+		typ:       reflect.TypeOf(obj),
+	}
+	if kvt.codec = kp.Codec; kvt.codec == nil {
+		kvt.codec = GobCodec{}
+	}
+	if err := kvt.saveCompression(kp.Compression); err != nil {
+		return nil, err
+	}
+	if err := kvt.saveEncryption(kp.Encryption); err != nil {
+		return nil, err
+	}
+	if kvt.unmarshal == nil {
+		if kvt.typ.Kind() != reflect.Struct || !reflect.PointerTo(kvt.typ).Implements(reflect.TypeOf((*KVer)(nil)).Elem()) {
+			return nil, fmt.Errorf(errCodecObj, kvt.typ)
+		}
+		kvt.unmarshal = kvt.codecUnmarshal
 	}
 
-	if err := kvt.saveIndexs(kp); err != nil {
+	//merge the indexs declared by struct tag, don't change the user's param
+	tagIndexs, tagMIndexs, err := parseTags(obj)
+	if err != nil {
+		return nil, err
+	}
+	param := *kp
+	param.Indexs = append(append([]IndexInfo{}, kp.Indexs...), tagIndexs...)
+	param.MIndexs = append(append([]MIndex{}, kp.MIndexs...), tagMIndexs...)
+
+	if err := kvt.saveIndexs(&param); err != nil {
+		return nil, err
+	}
+	if err := kvt.checkCoverEncrypted(); err != nil {
 		return nil, err
 	}
 
@@ -225,15 +392,49 @@ func New(obj any, kp *KVTParam) (kvt *KVT, err error) {
 	if err := kvt.checkIndexsFields(fields); err != nil {
 		return nil, err
 	}
+	if err := kvt.checkIndexsEncodable(obj, tagIndexs); err != nil {
+		return nil, err
+	}
+	if err := kvt.saveFields(&param, fields); err != nil {
+		return nil, err
+	}
 	return kvt, nil
 }
 
+// index key of obj, the tag declared indexs are always generated from the fields,
+// the others from the hand-written Index() if obj implements Indexer
+func (kvt *KVT) indexKey(obj KVer, index *IndexInfo) (ik []byte, err error) {
+	if v, ok := obj.(Indexer); ok && !index.auto {
+		ik, err = v.Index(index.Name)
+	} else {
+		ik, err = autoIndexKey(obj, index)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return index.directKey(ik), nil
+}
+
+// mindex keys of obj, from the MIndexFunc first, otherwise generate from the fields
+func (kvt *KVT) mindexKeys(obj KVer, mindex MIndex) (iks [][]byte, err error) {
+	if mindex.Key != nil {
+		iks, err = mindex.Key(obj)
+	} else {
+		iks, err = autoMIndexKeys(obj, mindex.IndexInfo)
+	}
+	for i := range iks {
+		iks[i] = mindex.directKey(iks[i])
+	}
+	return iks, err
+}
+
 // create main data bucket only
 func (kvt *KVT) CreateDataBucket(db Poler) (err error) {
-	_, _, err = db.CreateBucket(kvt.path)
+	_, offset, err := db.CreateBucket(kvt.path)
 	if err != nil {
 		return err
 	}
+	kvt.offset = offset
 	//kvt.path = string(prefix) //save prefix for Put/Delete
 	//v.offset = len(prefix)              //save prefix for query
 	return err
@@ -285,53 +486,168 @@ func (kvt *KVT) DeleteIndexBuckets(db Poler) error {
 	return nil
 }
 
+// check the unique index value is free, or owned by the pk self
+func (kvt *KVT) checkUniqueKey(db Poler, index *IndexInfo, ik, pk []byte) error {
+	if len(ik) == 0 {
+		return nil
+	}
+	pks, err := db.Query(index.path, ik, func([]byte) bool { return true })
+	if err != nil {
+		return err
+	}
+	for i := range pks {
+		if owner, _ := index.splitValue(pks[i].Value); !bytes.Equal(owner, pk) {
+			return &UniqueError{Index: index.Name, Value: ik, Key: owner}
+		}
+	}
+	return nil
+}
+
+// check all the unique index and mindex before write anything
+func (kvt *KVT) checkUnique(db Poler, obj KVer, pk []byte) error {
+	for i := range kvt.indexs {
+		if !kvt.indexs[i].Unique || !kvt.indexs[i].indexed(obj) {
+			continue
+		}
+		ik, err := kvt.indexKey(obj, kvt.indexs[i])
+		if err != nil {
+			return err
+		}
+		if err := kvt.checkUniqueKey(db, kvt.indexs[i], ik, pk); err != nil {
+			return err
+		}
+	}
+	for i := range kvt.mindexs {
+		if !kvt.mindexs[i].Unique || !kvt.mindexs[i].indexed(obj) {
+			continue
+		}
+		iks, err := kvt.mindexKeys(obj, kvt.mindexs[i])
+		if err != nil {
+			return err
+		}
+		for j := range iks {
+			if err := kvt.checkUniqueKey(db, kvt.mindexs[i].IndexInfo, iks[j], pk); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// insert or update the obj, see Insert/Update for the strict ones
 func (kvt *KVT) Put(db Poler, obj KVer) error {
+	return kvt.put(db, obj, nil)
+}
+
+// write the obj and its indexs, check the stored record first if check is not nil
+func (kvt *KVT) put(db Poler, obj KVer, check writeCheck) error {
 	key, _ := obj.Key()
-	value, _ := obj.Value()
+	value, err := kvt.value(obj)
+	if err == nil {
+		value, err = kvt.pack(key, value)
+	}
+	if err != nil {
+		return err
+	}
 
 	old, err := db.Get(kvt.path, key)
 	if err != nil {
 		return err
 	}
-
-	if len(old) > 0 { // update the exist INDEX
-		oldObj, err := kvt.unmarshal(old, nil)
-		if err != nil {
+	var oldValue []byte
+	var oldObj KVer
+	if len(old) > 0 {
+		if oldValue, err = kvt.unpack(key, old); err != nil {
+			return err
+		}
+		if oldObj, err = kvt.unmarshal(oldValue, nil); err != nil {
 			return err
 		}
+	}
+	if check != nil {
+		if err := check(key, oldValue, oldObj); err != nil {
+			return err
+		}
+	}
+
+	if err := kvt.checkUnique(db, obj, key); err != nil {
+		return err
+	}
+
+	if oldObj != nil { // update the exist INDEX
 		for i := range kvt.indexs {
-			kold, _ := oldObj.Index(kvt.indexs[i].Name)
-			knew, _ := obj.Index(kvt.indexs[i].Name)
-			if bytes.Equal(kold, knew) {
+			inOld, inNew := kvt.indexs[i].indexed(oldObj), kvt.indexs[i].indexed(obj)
+			var kold, knew []byte //the partial index keys of an obj outside it are never generated
+			if inOld {
+				if kold, err = kvt.indexKey(oldObj, kvt.indexs[i]); err != nil {
+					return err
+				}
+			}
+			if inNew {
+				if knew, err = kvt.indexKey(obj, kvt.indexs[i]); err != nil {
+					return err
+				}
+			}
+			if inOld && (!inNew || !bytes.Equal(kold, knew)) {
+				kold = AppendLastKey(kold, key)
+				if err = db.Delete(kvt.indexs[i].path, kold); err != nil {
+					return err
+				}
+			} else if inOld && !kvt.indexs[i].covering() { //covering index should refresh the projection
 				continue
 			}
-			kold = AppendLastKey(kold, key)
-			if err = db.Delete(kvt.indexs[i].path, kold); err != nil {
-				return err
+			if !inNew { //the obj leaves the partial index
+				continue
 			}
 			knew = AppendLastKey(knew, key) //index key should append primary key, to make sure it unique
-			if err := db.Put(kvt.indexs[i].path, knew, key); err != nil {
+			iv, err := kvt.indexs[i].indexValue(obj, key)
+			if err != nil {
+				return err
+			}
+			if err := db.Put(kvt.indexs[i].path, knew, iv); err != nil {
 				return err
 			}
 		}
 		//for mindex, we delete olds
-		kvt.deleteMIndex(db, oldObj, key)
+		if err := kvt.deleteMIndex(db, oldObj, key); err != nil {
+			return err
+		}
 	} else { //insert new index, and point to the primary key
 
 		for i := range kvt.indexs {
-			ik, _ := obj.Index(kvt.indexs[i].Name)
+			if !kvt.indexs[i].indexed(obj) {
+				continue
+			}
+			ik, err := kvt.indexKey(obj, kvt.indexs[i])
+			if err != nil {
+				return err
+			}
 			ik = AppendLastKey(ik, key) //index key should append primary key, to make sure it unique
-			if err := db.Put(kvt.indexs[i].path, ik, key); err != nil {
+			iv, err := kvt.indexs[i].indexValue(obj, key)
+			if err != nil {
+				return err
+			}
+			if err := db.Put(kvt.indexs[i].path, ik, iv); err != nil {
 				return err
 			}
 		}
 	}
 	//insert new MIndex
 	for i := range kvt.mindexs {
-		iks, _ := kvt.mindexs[i].Key(obj) //index key
+		if !kvt.mindexs[i].indexed(obj) {
+			continue
+		}
+		iks, err := kvt.mindexKeys(obj, kvt.mindexs[i]) //index key
+		if err != nil {
+			return err
+		}
+		iv, err := kvt.mindexs[i].indexValue(obj, key)
+		if err != nil {
+			return err
+		}
 		for j := range iks {
 			ik := AppendLastKey(iks[j], key) //index key should append primary key, to make sure it unique
-			if err := db.Put(kvt.mindexs[i].path, ik, key); err != nil {
+			if err := db.Put(kvt.mindexs[i].path, ik, iv); err != nil {
 				return err
 			}
 		}
@@ -340,9 +656,15 @@ func (kvt *KVT) Put(db Poler, obj KVer) error {
 	return db.Put(kvt.path, key, value)
 }
 
-func (kvt *KVT) deleteMIndex(db Poler, obj any, pk []byte) error {
+func (kvt *KVT) deleteMIndex(db Poler, obj KVer, pk []byte) error {
 	for i := range kvt.mindexs {
-		kolds, _ := kvt.mindexs[i].Key(obj)
+		if !kvt.mindexs[i].indexed(obj) {
+			continue
+		}
+		kolds, err := kvt.mindexKeys(obj, kvt.mindexs[i])
+		if err != nil {
+			return err
+		}
 		for j := range kolds {
 			kold := AppendLastKey(kolds[j], pk)
 			if err := db.Delete(kvt.mindexs[i].path, kold); err != nil {
@@ -360,12 +682,18 @@ func (kvt *KVT) Delete(db Poler, obj KVer) error {
 		return err
 	}
 
-	oldObj, err := kvt.unmarshal(old, nil)
+	oldObj, err := kvt.load(key, old, nil)
 	if err != nil {
 		return err
 	}
 	for i := range kvt.indexs {
-		kold, _ := oldObj.Index(kvt.indexs[i].Name)
+		if !kvt.indexs[i].indexed(oldObj) {
+			continue
+		}
+		kold, err := kvt.indexKey(oldObj, kvt.indexs[i])
+		if err != nil {
+			return err
+		}
 		kold = AppendLastKey(kold, key)
 		if err := db.Delete(kvt.indexs[i].path, kold); err != nil {
 			return err
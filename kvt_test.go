@@ -215,3 +215,106 @@ func (obj *order2) idx_Type_Status() ([]byte, error) {
 		Bytes(Ptr(&obj.Status), unsafe.Sizeof(obj.Status))) //every index should append primary key at end
 	return key, nil
 }
+
+// member has no Index(), all its indexs are generated from the kvt tag
+type member struct {
+	ID    uint64
+	Email string   `kvt:"idx_Email:unique"`
+	Name  string   `kvt:"idx_Level_Name:1"`
+	Level int      `kvt:"idx_Level_Name:0"`
+	Score float64  `kvt:"idx_Score"`
+	Tags  []string `kvt:"midx_Tags"`
+}
+
+func memberUnmarshal(b []byte, obj KVer) (KVer, error) {
+	r := bytes.NewReader(b)
+	dec := gob.NewDecoder(r)
+
+	p, ok := obj.(*member)
+	if !ok {
+		p = new(member)
+	}
+	if err := dec.Decode(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (obj *member) Key() ([]byte, error) {
+	return EncodeUint64(obj.ID), nil
+}
+
+func (obj *member) Value() ([]byte, error) {
+	var network bytes.Buffer // Stand-in for the network.
+	// Create an encoder and send a value.
+	enc := gob.NewEncoder(&network)
+	enc.Encode(obj)
+
+	return network.Bytes(), nil
+}
+
+// countPoler count the keys scanned, to check the scan stop early
+type countPoler struct {
+	Poler
+	scanned int
+}
+
+func (p *countPoler) Scan(path string, info ScanInfo, fn ScanFunc) error {
+	return p.Poler.Scan(path, info, func(k, v []byte) bool {
+		p.scanned++
+		return fn(k, v)
+	})
+}
+
+// note has no Value() and no Unmarshal func, KVT marshals it by the Codec
+type note struct {
+	ID    uint64
+	Title string `kvt:"idx_Title"`
+	At    time.Time
+	Stars map[string]int
+	Refs  []uint64
+	Prev  *note
+	skip  int
+}
+
+func (obj *note) Key() ([]byte, error) {
+	return EncodeUint64(obj.ID), nil
+}
+
+// account carries a version for UpdateVersion, it has no Value() either
+type account struct {
+	ID      uint64
+	Owner   string `kvt:"idx_Owner:unique"`
+	Balance int
+	Ver     uint64
+}
+
+func (obj *account) Key() ([]byte, error) {
+	return EncodeUint64(obj.ID), nil
+}
+
+func (obj *account) Version() uint64 {
+	return obj.Ver
+}
+
+// tagged has a tag declared index and a hand-written Index() for the others
+type tagged struct {
+	ID   uint64
+	Name string `kvt:"idx_Name"`
+	Code string
+}
+
+func (obj *tagged) Key() ([]byte, error) {
+	return EncodeUint64(obj.ID), nil
+}
+
+func (obj *tagged) Index(name string) ([]byte, error) {
+	switch name {
+	case "idx_Code":
+		if obj.Code == "" {
+			return nil, fmt.Errorf("code missing")
+		}
+		return MakeIndexKey(nil, EncodeString("code-"+obj.Code)), nil //encoded another way than the fields
+	}
+	return MakeIndexKey(nil, EncodeString("hand-written")), nil
+}
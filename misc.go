@@ -1,6 +1,7 @@
 package kvt
 
 import (
+	"bytes"
 	"reflect"
 	"runtime"
 	"strings"
@@ -23,14 +24,14 @@ func RealErr(err error) bool {
 // make up several field bytes into a index key
 func MakeIndexKey(dst, k1 []byte, slc ...[]byte) []byte {
 
-	dst = joinKeyWithTokenEscaped(defaultKeyJoiner, defaultKeyEscaper, dst, k1)
+	dst = escapeKey(dst, k1)
 	//always append a token after a key end
-	dst = append(dst, defaultKeyJoiner)
+	dst = append(dst, keyEscaper, keyTerminator)
 
 	for i := range slc {
-		dst = joinKeyWithTokenEscaped(defaultKeyJoiner, defaultKeyEscaper, dst, slc[i])
+		dst = escapeKey(dst, slc[i])
 		//always append a token after a key end
-		dst = append(dst, defaultKeyJoiner)
+		dst = append(dst, keyEscaper, keyTerminator)
 	}
 	return dst
 }
@@ -38,20 +39,41 @@ func MakeIndexKey(dst, k1 []byte, slc ...[]byte) []byte {
 // split a index key to several field bytes
 func SplitIndexKey(content []byte) (result [][]byte) {
 
-	result = doSplitIndexKey(defaultKeyEscaper, defaultKeyJoiner, content, []byte{}, [][]byte{})
+	key := []byte{}
+	ended := false
+	for i := 0; i < len(content); i++ {
+		ended = false
+		if content[i] != keyEscaper || i == len(content)-1 {
+			key = append(key, content[i])
+			continue
+		}
+		i++
+		switch content[i] {
+		case keyEscaped:
+			key = append(key, keyEscaper)
+		default: //the token after a key end
+			result = append(result, key)
+			key = []byte{}
+			ended = true
+		}
+	}
+	if !ended {
+		result = append(result, key)
+	}
 	return result
 }
 
 // without a tail token compare with MakeIndexKey
 func AppendLastKey(dst, raw []byte) []byte {
-	return joinKeyWithTokenEscaped(defaultKeyJoiner, defaultKeyEscaper, dst, raw)
+	return escapeKey(dst, raw)
 }
 
-func joinKeyWithTokenEscaped(token, escaper byte, dst, k1 []byte) []byte {
+// escape 0x00 as 0x00 0xFF, it keeps the order of the keys
+func escapeKey(dst, k1 []byte) []byte {
 	for i := range k1 {
 		switch k1[i] {
-		case token, escaper:
-			dst = append(dst, escaper, k1[i])
+		case keyEscaper:
+			dst = append(dst, keyEscaper, keyEscaped)
 		default:
 			dst = append(dst, k1[i])
 		}
@@ -77,38 +99,6 @@ func JoinKeysWithTokenEscaped(token, escaper byte, dst, k1 []byte, slc ...[]byte
 	return dst
 }
 
-func doSplitIndexKey(escaper, token byte, content []byte, key []byte, result [][]byte) [][]byte {
-	switch len(content) {
-	case 0:
-		result = append(result, key)
-		return result
-	case 1:
-		switch content[0] {
-		case escaper, token:
-			result = append(result, key)
-			return result
-		default:
-			key = append(key, content[0])
-			result = append(result, key)
-			return result
-		}
-	default: // len > 1
-		for i := 0; i < len(content)-1; i++ {
-			switch content[i] {
-			case escaper:
-				key = append(key, content[i+1])
-				return doSplitIndexKey(escaper, token, content[i+2:], key, result)
-			case token:
-				result = append(result, key)
-				key = []byte{}
-			default:
-				key = append(key, content[i])
-			}
-		}
-		return doSplitIndexKey(escaper, token, content[len(content)-1:], key, result)
-	}
-}
-
 func getFunctionName(i any) string {
 	return basename(runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name())
 }
@@ -135,3 +125,25 @@ func Dos(actions []Action) error {
 	}
 	return nil
 }
+
+// the smallest key larger than all the keys with the prefix, nil if not exists(all 0xFF)
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xFF {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// the lowest key of the index keys whose field(after prefix) >= v, v is the stored field bytes
+func lowerBound(prefix, v []byte) []byte {
+	return escapeKey(bytes.Clone(prefix), v)
+}
+
+// the key after all the index keys whose field(after prefix) <= v, v is the stored field bytes
+func upperBound(prefix, v []byte) []byte {
+	return prefixEnd(MakeIndexKey(bytes.Clone(prefix), v))
+}
@@ -0,0 +1,489 @@
+package kvt
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const errQuerySyntax = "query syntax error at %d near [%s]: %s"
+
+// ParseRange/ParseQuery returns it when the text query is invalid
+type ParseError struct {
+	Query string //the text query
+	Pos   int    //byte offset of the offending token
+	Token string //the offending token, empty at the end of query
+	Msg   string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf(errQuerySyntax, e.Pos, e.Token, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenIdent
+	tokenString //"..."
+	tokenTime   //t"..."
+	tokenBytes  //x"..."
+	tokenNumber
+	tokenSymbol //operators and punctuations
+)
+
+type token struct {
+	kind tokenKind
+	text string //raw text, unquoted for the string tokens
+	pos  int    //byte offset in the query
+	end  int
+}
+
+func isIdentChar(c byte, first bool) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || (!first && '0' <= c && c <= '9')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// split the query into tokens
+func lexQuery(query string) ([]token, error) {
+	var tokens []token
+	fail := func(pos int, text, msg string) error {
+		return &ParseError{Query: query, Pos: pos, Token: text, Msg: msg}
+	}
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '`' || ((c == 't' || c == 'x') && i+1 < len(query) && query[i+1] == '"'):
+			kind, start := tokenString, i
+			if c == 't' || c == 'x' {
+				kind = map[byte]tokenKind{'t': tokenTime, 'x': tokenBytes}[c]
+				i++
+			}
+			quote := query[i]
+			j := i + 1
+			for j < len(query) && query[j] != quote {
+				if query[j] == '\\' && quote == '"' {
+					j++
+				}
+				j++
+			}
+			if j >= len(query) {
+				return nil, fail(start, query[start:], "unterminated string")
+			}
+			s, err := strconv.Unquote(query[i : j+1])
+			if err != nil {
+				return nil, fail(start, query[start:j+1], "invalid string")
+			}
+			tokens = append(tokens, token{kind, s, start, j + 1})
+			i = j + 1
+		case isIdentChar(c, true):
+			j := i + 1
+			for j < len(query) && isIdentChar(query[j], false) {
+				j++
+			}
+			tokens = append(tokens, token{tokenIdent, query[i:j], i, j})
+			i = j
+		case isDigit(c) || ((c == '-' || c == '+') && i+1 < len(query) && isDigit(query[i+1])):
+			j := i + 1
+			for j < len(query) {
+				d := query[j]
+				if isIdentChar(d, false) || d == '.' {
+					j++
+				} else if (d == '-' || d == '+') && (query[j-1] == 'e' || query[j-1] == 'E') {
+					j++
+				} else {
+					break
+				}
+			}
+			tokens = append(tokens, token{tokenNumber, query[i:j], i, j})
+			i = j
+		case c == '(' || c == ')' || c == ',' || c == ':':
+			tokens = append(tokens, token{tokenSymbol, query[i : i+1], i, i + 1})
+			i++
+		case strings.IndexByte("=!<>", c) >= 0:
+			j := i + 1
+			if j < len(query) && query[j] == '=' {
+				j++
+			}
+			tokens = append(tokens, token{tokenSymbol, query[i:j], i, j})
+			i = j
+		default:
+			return nil, fail(i, query[i:i+1], "unexpected char")
+		}
+	}
+	return append(tokens, token{tokenEnd, "", len(query), len(query)}), nil
+}
+
+type queryParser struct {
+	kvt    *KVT
+	query  string
+	tokens []token
+	next   int
+	simple bool //for QueryInfo, = conditions and LIMIT only
+}
+
+func (p *queryParser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+func (p *queryParser) fail(t token, format string, args ...any) error {
+	return &ParseError{Query: p.query, Pos: t.pos, Token: p.query[t.pos:t.end], Msg: fmt.Sprintf(format, args...)}
+}
+
+// true and take it if the next token is the keyword
+func (p *queryParser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == tokenIdent && strings.EqualFold(t.text, word) {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) expect(symbol string) error {
+	t := p.take()
+	if t.kind != tokenSymbol || t.text != symbol {
+		return p.fail(t, "expect [%s]", symbol)
+	}
+	return nil
+}
+
+// the type of a literal of the field, a slice field of mindex takes its element type
+func (p *queryParser) fieldType(name string) (reflect.Type, bool) {
+	if p.kvt.typ == nil {
+		return nil, false
+	}
+	f, ok := p.kvt.typ.FieldByName(name)
+	if !ok {
+		return nil, false
+	}
+	t := f.Type
+	if (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && !encodableType(t) {
+		t = t.Elem()
+	}
+	return t, true
+}
+
+// the go value of a literal for the field's Encode func
+func literalValue(t token) (any, error) {
+	switch t.kind {
+	case tokenString:
+		return t.text, nil
+	case tokenBytes:
+		return hex.DecodeString(t.text)
+	case tokenTime:
+		return time.Parse(time.RFC3339Nano, t.text)
+	case tokenNumber:
+		if v, err := strconv.ParseInt(t.text, 0, 64); err == nil {
+			return v, nil
+		}
+		if v, err := strconv.ParseUint(t.text, 0, 64); err == nil {
+			return v, nil
+		}
+		return strconv.ParseFloat(t.text, 64)
+	case tokenIdent:
+		return strconv.ParseBool(strings.ToLower(t.text))
+	}
+	return nil, fmt.Errorf("not a literal")
+}
+
+// encode a literal with the field's Encode func, or the encoder of the field type
+func (p *queryParser) literal(field string) ([]byte, error) {
+	t := p.take()
+	if t.kind == tokenEnd || t.kind == tokenSymbol {
+		return nil, p.fail(t, "expect a literal")
+	}
+	if encode := p.kvt.fields[field].Encode; encode != nil {
+		v, err := literalValue(t)
+		if err != nil {
+			return nil, p.fail(t, "invalid literal: %s", err)
+		}
+		b, err := encode(v)
+		if err != nil {
+			return nil, p.fail(t, "encode literal failed: %s", err)
+		}
+		return b, nil
+	}
+
+	ft, ok := p.fieldType(field)
+	if !ok {
+		return nil, p.fail(t, "field [%s] type unknown", field)
+	}
+	v := reflect.New(ft).Elem()
+	mismatch := func() error {
+		return p.fail(t, "literal mismatch field [%s] of type %s", field, ft)
+	}
+	switch {
+	case ft == timeType:
+		if t.kind != tokenTime && t.kind != tokenString {
+			return nil, mismatch()
+		}
+		tm, err := time.Parse(time.RFC3339Nano, t.text)
+		if err != nil {
+			return nil, p.fail(t, "invalid time: %s", err)
+		}
+		v.Set(reflect.ValueOf(tm))
+	case ft.Kind() == reflect.String:
+		if t.kind != tokenString {
+			return nil, mismatch()
+		}
+		v.SetString(t.text)
+	case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Uint8:
+		switch t.kind {
+		case tokenString:
+			v.SetBytes([]byte(t.text))
+		case tokenBytes:
+			b, err := hex.DecodeString(t.text)
+			if err != nil {
+				return nil, p.fail(t, "invalid hex bytes")
+			}
+			v.SetBytes(b)
+		default:
+			return nil, mismatch()
+		}
+	case ft.Kind() == reflect.Bool:
+		b, err := literalValue(t)
+		if t.kind != tokenIdent || err != nil {
+			return nil, mismatch()
+		}
+		v.SetBool(b.(bool))
+	case v.CanInt():
+		n, err := strconv.ParseInt(t.text, 0, 64)
+		if t.kind != tokenNumber || err != nil || v.OverflowInt(n) {
+			return nil, mismatch()
+		}
+		v.SetInt(n)
+	case v.CanUint():
+		n, err := strconv.ParseUint(t.text, 0, 64)
+		if t.kind != tokenNumber || err != nil || v.OverflowUint(n) {
+			return nil, mismatch()
+		}
+		v.SetUint(n)
+	case v.CanFloat():
+		f, err := strconv.ParseFloat(t.text, 64)
+		if t.kind != tokenNumber || err != nil {
+			return nil, mismatch()
+		}
+		v.SetFloat(f)
+	default:
+		return nil, mismatch()
+	}
+	b, err := encodeReflect(v)
+	if err != nil {
+		return nil, p.fail(t, "%s", err)
+	}
+	return b, nil
+}
+
+// ( literal, literal ... )
+func (p *queryParser) literalList(field string) ([]byte, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var values [][]byte
+	for {
+		v, err := p.literal(field)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		t := p.take()
+		if t.kind == tokenSymbol && t.text == ")" {
+			return MakeValues(values...), nil
+		}
+		if t.kind != tokenSymbol || t.text != "," {
+			return nil, p.fail(t, "expect [,] or [)]")
+		}
+	}
+}
+
+// field operator value
+func (p *queryParser) condition(index *IndexInfo, where map[string]map[string][]byte) error {
+	t := p.take()
+	if t.kind != tokenIdent {
+		return p.fail(t, "expect a field name")
+	}
+	field := t.text
+	if !slices.Contains(index.Fields, field) {
+		return p.fail(t, "field [%s] not in index [%s]", field, index.Name)
+	}
+
+	opToken := p.peek()
+	var op string
+	var value []byte
+	var err error
+	switch {
+	case p.keyword("not"):
+		if !p.keyword("in") {
+			return p.fail(p.peek(), "expect [IN] after [NOT]")
+		}
+		op = "not in"
+		value, err = p.literalList(field)
+	case p.keyword("in"):
+		op = "in"
+		value, err = p.literalList(field)
+	case p.keyword("between"):
+		op = "between"
+		var lo, hi []byte
+		if lo, err = p.literal(field); err != nil {
+			return err
+		}
+		if !p.keyword("and") {
+			return p.fail(p.peek(), "expect [AND] in [BETWEEN]")
+		}
+		if hi, err = p.literal(field); err != nil {
+			return err
+		}
+		value = MakeValues(lo, hi)
+	case opToken.kind == tokenSymbol || opToken.kind == tokenIdent:
+		p.take()
+		op = cmpOperator(opToken.text)
+		if _, ok := p.kvt.compareFunc(field, op); !ok {
+			return p.fail(opToken, "unknown operator")
+		}
+		if p.simple && op != "=" && op != "==" {
+			break
+		}
+		value, err = p.literal(field)
+	default:
+		return p.fail(opToken, "expect an operator")
+	}
+	if err != nil {
+		return err
+	}
+	if p.simple && op != "=" && op != "==" {
+		return p.fail(opToken, "only [=] is supported by a simple query")
+	}
+
+	if where[field] == nil {
+		where[field] = make(map[string][]byte)
+	}
+	if _, ok := where[field][op]; ok || (p.simple && len(where[field]) > 0) {
+		return p.fail(opToken, "duplicate operator on field [%s]", field)
+	}
+	where[field][op] = value
+	return nil
+}
+
+// LIMIT n, OFFSET n, REVERSE at the end
+func (p *queryParser) options(rangeInfo *RangeInfo) error {
+	for p.peek().kind != tokenEnd {
+		if t := p.peek(); p.simple && !strings.EqualFold(t.text, "limit") && isOptionWord(t.text) {
+			return p.fail(t, "only [LIMIT] is supported by a simple query")
+		}
+		switch {
+		case p.keyword("reverse"):
+			rangeInfo.Reverse = true
+		case p.keyword("limit"), p.keyword("offset"):
+			word := strings.ToLower(p.tokens[p.next-1].text)
+			t := p.take()
+			n, err := strconv.Atoi(t.text)
+			if t.kind != tokenNumber || err != nil || n < 0 {
+				return p.fail(t, "expect a non-negative number")
+			}
+			if word == "limit" {
+				rangeInfo.Limit = n
+			} else {
+				rangeInfo.Offset = n
+			}
+		default:
+			return p.fail(p.peek(), "expect [AND], [LIMIT], [OFFSET], [REVERSE] or the end")
+		}
+	}
+	return nil
+}
+
+func (p *queryParser) parse() (RangeInfo, error) {
+	rangeInfo := RangeInfo{Where: make(map[string]map[string][]byte)}
+
+	t := p.take()
+	if t.kind != tokenIdent {
+		return rangeInfo, p.fail(t, "expect an index name")
+	}
+	index, err := p.kvt.getIndexInfo(t.text)
+	if err != nil {
+		return rangeInfo, p.fail(t, "index not found")
+	}
+	rangeInfo.IndexName = t.text
+	if err := p.expect(":"); err != nil {
+		return rangeInfo, err
+	}
+
+	if next := p.peek(); next.kind == tokenIdent && !isOptionWord(next.text) {
+		for {
+			if err := p.condition(index, rangeInfo.Where); err != nil {
+				return rangeInfo, err
+			}
+			if !p.keyword("and") {
+				break
+			}
+		}
+	}
+	return rangeInfo, p.options(&rangeInfo)
+}
+
+func isOptionWord(s string) bool {
+	for _, w := range []string{"limit", "offset", "reverse"} {
+		if strings.EqualFold(s, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// parse a text query to RangeInfo, an index name and its conditions joined by AND:
+//
+//	idx_Type_Status: Type = "book" AND Status >= 2 LIMIT 10
+//	idx_Level_Name: Level IN (1, 2) AND Name PREFIX "Al" REVERSE OFFSET 5
+//	idx_Birth: Birth BETWEEN t"2000-01-01T00:00:00Z" AND t"2010-01-01T00:00:00Z"
+//
+// operators: = == != < > <= >= IN, NOT IN, BETWEEN, PREFIX and the custom ones named by an identifier,
+// literals: "string", number, true/false, t"RFC3339 time", x"hex bytes",
+// a literal is encoded by the field's Encode func, or the order preserving encoder of the field type,
+// keywords are case insensitive
+func (kvt *KVT) ParseRange(query string) (RangeInfo, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return RangeInfo{}, err
+	}
+	p := &queryParser{kvt: kvt, query: query, tokens: tokens}
+	return p.parse()
+}
+
+// parse a text query to QueryInfo, = conditions and LIMIT only, see ParseRange
+func (kvt *KVT) ParseQuery(query string) (QueryInfo, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return QueryInfo{}, err
+	}
+	p := &queryParser{kvt: kvt, query: query, tokens: tokens, simple: true}
+	rangeInfo, err := p.parse()
+	if err != nil {
+		return QueryInfo{}, err
+	}
+
+	info := QueryInfo{IndexName: rangeInfo.IndexName, Where: make(map[string][]byte, len(rangeInfo.Where)), Limit: rangeInfo.Limit}
+	for field, ops := range rangeInfo.Where {
+		for _, v := range ops {
+			info.Where[field] = v
+		}
+	}
+	return info, nil
+}
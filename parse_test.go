@@ -0,0 +1,163 @@
+package kvt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestParseRange(t *testing.T) {
+	kp := KVTParam{
+		Bucket:    "Bucket_member",
+		Unmarshal: memberUnmarshal,
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := k.ParseRange(`idx_Level_Name: Level IN (1, 3) and Name prefix "Al" AND Name != "Alan" reverse LIMIT 10 offset 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RangeInfo{
+		IndexName: "idx_Level_Name",
+		Where: map[string]map[string][]byte{
+			"Level": {"in": MakeValues(EncodeInt64(1), EncodeInt64(3))},
+			"Name":  {"prefix": EncodeString("Al"), "!=": EncodeString("Alan")},
+		},
+		Reverse: true,
+		Limit:   10,
+		Offset:  2,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parse mismatch:\n%+v\n%+v", got, want)
+	}
+
+	got, err = k.ParseRange(`idx_Score: Score BETWEEN -1.5 AND 2e3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := got.Where["Score"]["between"]; !reflect.DeepEqual(v, MakeValues(EncodeFloat64(-1.5), EncodeFloat64(2000))) {
+		t.Errorf("between mismatch: %x", v)
+	}
+
+	//the element type of a mindex slice field
+	got, err = k.ParseRange("midx_Tags: Tags = `go`")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := got.Where["Tags"]["="]; !reflect.DeepEqual(v, EncodeString("go")) {
+		t.Errorf("mindex literal mismatch: %x", v)
+	}
+
+	q, err := k.ParseQuery(`idx_Level_Name: Level = 2 AND Name == "Bob" LIMIT 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantQuery := QueryInfo{
+		IndexName: "idx_Level_Name",
+		Where:     map[string][]byte{"Level": EncodeInt64(2), "Name": EncodeString("Bob")},
+		Limit:     1,
+	}
+	if !reflect.DeepEqual(q, wantQuery) {
+		t.Errorf("query mismatch:\n%+v\n%+v", q, wantQuery)
+	}
+}
+
+func TestParseEncode(t *testing.T) {
+	//the hand-written idx_Type_Status stores Status in its memory layout
+	kp := KVTParam{
+		Bucket:    "Bucket_order",
+		Unmarshal: orderUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_Type_Status", Fields: []string{"Type", "Status"}},
+		},
+		Fields: map[string]FieldInfo{
+			"Status": {Encode: func(v any) ([]byte, error) {
+				n, ok := v.(int64)
+				if !ok || n < 0 || n > 0xffff {
+					return nil, fmt.Errorf("invalid status %v", v)
+				}
+				status := uint16(n)
+				return Bytes(Ptr(&status), unsafe.Sizeof(status)), nil
+			}},
+		},
+	}
+	k, err := New(order{}, &kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := k.ParseRange(`idx_Type_Status: Type = "book" AND Status >= 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := uint16(2)
+	if v := got.Where["Status"][">="]; !reflect.DeepEqual(v, Bytes(Ptr(&status), unsafe.Sizeof(status))) {
+		t.Errorf("encode mismatch: %x", v)
+	}
+
+	if _, err := k.ParseRange(`idx_Type_Status: Status = 70000`); err == nil {
+		t.Errorf("encode error expected")
+	}
+}
+
+func TestParseError(t *testing.T) {
+	kp := KVTParam{
+		Bucket:    "Bucket_member",
+		Unmarshal: memberUnmarshal,
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		query string
+		pos   int
+		token string
+	}{
+		{`idx_Nope: Level = 1`, 0, "idx_Nope"},
+		{`idx_Level_Name Level = 1`, 15, "Level"},
+		{`idx_Level_Name: Score = 1`, 16, "Score"},
+		{`idx_Level_Name: Level ~ 1`, 22, "~"},
+		{`idx_Level_Name: Level like 1`, 22, "like"},
+		{`idx_Level_Name: Level = "one"`, 24, `"one"`},
+		{`idx_Level_Name: Level = 1.5`, 24, "1.5"},
+		{`idx_Level_Name: Name = "Al`, 23, `"Al`},
+		{`idx_Level_Name: Level IN (1, 2`, 30, ""},
+		{`idx_Level_Name: Level = 1 AND Level = 2`, 36, "="},
+		{`idx_Level_Name: Level BETWEEN 1 OR 2`, 32, "OR"},
+		{`idx_Level_Name: Level = 1 LIMIT -1`, 32, "-1"},
+		{`idx_Level_Name: Level = 1 Name = "a"`, 26, "Name"},
+		{`idx_Level_Name: Level NOT 1`, 26, "1"},
+		{`idx_Level_Name: Level =`, 23, ""},
+	}
+	for _, c := range cases {
+		_, err := k.ParseRange(c.query)
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("%s: ParseError expected, got %v", c.query, err)
+			continue
+		}
+		if pe.Pos != c.pos || pe.Token != c.token {
+			t.Errorf("%s: error at %d [%s], expect %d [%s]: %v", c.query, pe.Pos, pe.Token, c.pos, c.token, err)
+		}
+	}
+
+	//a simple query accepts = and LIMIT only
+	for query, token := range map[string]string{
+		`idx_Level_Name: Level >= 1`:              ">=",
+		`idx_Level_Name: Level = 1 REVERSE`:       "REVERSE",
+		`idx_Level_Name: Level = 1 AND Level = 2`: "=",
+	} {
+		_, err := k.ParseQuery(query)
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Token != token {
+			t.Errorf("%s: error at [%s] expected, got %v", query, token, err)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package kvt
 
+import "bytes"
+
 type Poler interface {
 	CreateBucket(path string) ([]byte, int, error)
 	DeleteBucket(path string) error
@@ -9,9 +11,55 @@ type Poler interface {
 	Delete(path string, k []byte) error
 	//Query
 	Query(path string, prefix []byte, filter FilterFunc) ([]KVPair, error)
+	//Scan call fn with kv pairs in key order, stop when fn return false
+	Scan(path string, info ScanInfo, fn ScanFunc) error
 
 	//sequence api
 	Sequence(path string) (uint64, error)
 	NextSequence(path string) (uint64, error)
 	SetSequence(path string, seq uint64) error
 }
+
+// scan options, zero value scan all the keys in ascending order
+type ScanInfo struct {
+	Prefix  []byte //only the keys with the prefix
+	Reverse bool   //scan in descending key order
+	After   []byte //resume after this key(exclusive), the key is without bucket prefix
+	Start   []byte //lower bound(inclusive), nil means no limit, the key is without bucket prefix
+	End     []byte //upper bound(exclusive), nil means no limit, the key is without bucket prefix
+}
+
+// the first key of an ascending scan, seek to it and skip it if it's the After key
+func (info *ScanInfo) lower() []byte {
+	lower := info.Prefix
+	if bytes.Compare(info.Start, lower) > 0 {
+		lower = info.Start
+	}
+	if info.After != nil && bytes.Compare(info.After, lower) >= 0 {
+		lower = info.After
+	}
+	return lower
+}
+
+// the key(exclusive) where a descending scan begin, nil means from the last key
+func (info *ScanInfo) upper() []byte {
+	upper := prefixEnd(info.Prefix)
+	for _, v := range [][]byte{info.End, info.After} {
+		if v != nil && (upper == nil || bytes.Compare(v, upper) < 0) {
+			upper = v
+		}
+	}
+	return upper
+}
+
+// check the key is still in the scan window, stop the scan if not
+func (info *ScanInfo) inRange(k []byte) bool {
+	return bytes.HasPrefix(k, info.Prefix) &&
+		(info.Start == nil || bytes.Compare(k, info.Start) >= 0) &&
+		(info.End == nil || bytes.Compare(k, info.End) < 0)
+}
+
+// optional, a Poler implement it if it can count the keys of a bucket without a scan
+type Counter interface {
+	Count(path string) (int, error)
+}
@@ -87,6 +87,56 @@ func (this *boltdb) Query(path string, prefix []byte, filter FilterFunc) (result
 	return result, nil
 }
 
+func (this *boltdb) Scan(path string, info ScanInfo, fn ScanFunc) error {
+	b := this.tx.Bucket([]byte(path))
+	if b == nil {
+		return fmt.Errorf(errBucketOpenFailed, path)
+	}
+	c := b.Cursor()
+
+	if info.Reverse {
+		var k, v []byte
+		//seek to the upper key, then step back
+		if upper := info.upper(); upper == nil {
+			k, v = c.Last()
+		} else if k, _ = c.Seek(upper); k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil && info.inRange(k); k, v = c.Prev() {
+			if !fn(k, v) {
+				break
+			}
+		}
+		return nil
+	}
+
+	k, v := c.Seek(info.lower())
+	if info.After != nil && bytes.Equal(k, info.After) {
+		k, v = c.Next()
+	}
+	for ; k != nil && info.inRange(k); k, v = c.Next() {
+		if !fn(k, v) {
+			break
+		}
+	}
+	return nil
+}
+
+// Stats() reads the committed pages only, so count with a cursor to see the writes of this tx
+func (this *boltdb) Count(path string) (n int, err error) {
+	b := this.tx.Bucket([]byte(path))
+	if b == nil {
+		return 0, fmt.Errorf(errBucketOpenFailed, path)
+	}
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		n++
+	}
+	return n, nil
+}
+
 func (this *boltdb) Sequence(path string) (seq uint64, err error) {
 	b := this.tx.Bucket([]byte(path))
 	if b == nil {
@@ -4,6 +4,7 @@
 package kvt
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 	"unsafe"
@@ -118,6 +119,39 @@ func (this *bunt) Query(path string, prefix []byte, filter FilterFunc) (result [
 	return result, err
 }
 
+// scan with the key range instead of pattern, pattern treat '*' and '?' in the prefix as wildcard
+func (this *bunt) Scan(path string, info ScanInfo, fn ScanFunc) error {
+	base := path + string(defaultKeyJoiner)
+	iter := func(key, value string) bool {
+		if !strings.HasPrefix(key, base) {
+			return false
+		}
+		k := []byte(key[len(base):])
+		if !info.inRange(k) {
+			return false
+		}
+		if info.After != nil && bytes.Equal(k, info.After) {
+			return true
+		}
+		return fn([]byte(key), []byte(value))
+	}
+
+	if info.Reverse {
+		upper := string(prefixEnd([]byte(base)))
+		if v := info.upper(); v != nil {
+			upper = base + string(v)
+		}
+		return this.tx.DescendLessOrEqual("", upper, func(key, value string) bool {
+			if key == upper {
+				return true
+			}
+			return iter(key, value)
+		})
+	}
+
+	return this.tx.AscendGreaterOrEqual("", base+string(info.lower()), iter)
+}
+
 func (this *bunt) Sequence(path string) (seq uint64, err error) {
 
 	v, err := this.get(path, []byte(sequenceName), defaultPathJoiner)
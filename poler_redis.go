@@ -4,8 +4,10 @@
 package kvt
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/redis/go-redis/v9"
@@ -14,12 +16,14 @@ import (
 const errRedisNil = "redis: nil"
 
 type redisdb struct {
-	rdb  *redis.Client
+	rdb  redis.Cmdable //reads go through it, writes are queued in pipe
 	pipe redis.Pipeliner
 	ctx  context.Context
 }
 
-func NewRedisPoler(cli *redis.Client, p redis.Pipeliner, ct context.Context) Poler {
+// cli reads and p writes, give a *redis.Tx of client.Watch as cli, and its TxPipelined pipe as p,
+// then the writes are dropped if the watched keys changed after the reads, see KVT.CompareAndUpdate
+func NewRedisPoler(cli redis.Cmdable, p redis.Pipeliner, ct context.Context) Poler {
 	return &redisdb{rdb: cli, pipe: p, ctx: ct}
 }
 
@@ -98,6 +102,81 @@ func (this *redisdb) Query(path string, prefix []byte, filter FilterFunc) (resul
 	return result, err
 }
 
+// escape the glob chars of HSCAN MATCH
+func escapeGlob(prefix []byte) string {
+	var b strings.Builder
+	for _, c := range prefix {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// redis hash has no order, so we have to load all the matched pairs and sort them
+func (this *redisdb) Scan(path string, info ScanInfo, fn ScanFunc) error {
+	result := make([]KVPair, 0)
+
+	realPrefix := escapeGlob(info.Prefix) + "*"
+	var cursor uint64
+	for {
+		var keys []string
+		var err error
+		keys, cursor, err = this.rdb.HScan(this.ctx, path, cursor, realPrefix, 100).Result()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(keys); i += 2 {
+			if keys[i] != sequenceName {
+				result = append(result, KVPair{Key: []byte(keys[i]), Value: []byte(keys[i+1])})
+			}
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if info.Reverse {
+			return bytes.Compare(result[i].Key, result[j].Key) > 0
+		}
+		return bytes.Compare(result[i].Key, result[j].Key) < 0
+	})
+	for i := range result {
+		if !info.inRange(result[i].Key) {
+			continue
+		}
+		if info.After != nil {
+			c := bytes.Compare(result[i].Key, info.After)
+			if (!info.Reverse && c <= 0) || (info.Reverse && c >= 0) {
+				continue
+			}
+		}
+		if !fn(result[i].Key, result[i].Value) {
+			break
+		}
+	}
+	return nil
+}
+
+// the sequence is saved in the same hash, exclude it
+func (this *redisdb) Count(path string) (int, error) {
+	n, err := this.rdb.HLen(this.ctx, path).Result()
+	if err != nil {
+		return 0, err
+	}
+	seq, err := this.rdb.HExists(this.ctx, path, sequenceName).Result()
+	if err != nil {
+		return 0, err
+	}
+	if seq {
+		n--
+	}
+	return int(n), nil
+}
+
 func (this *redisdb) Sequence(path string) (seq uint64, err error) {
 
 	scmd := this.rdb.HGet(this.ctx, path, sequenceName)
@@ -2,17 +2,47 @@ package kvt
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
+	"slices"
 	"strings"
 )
 
+// IN/NOT IN/BETWEEN take several values packed by MakeValues, BETWEEN is inclusive
 var cmpFunctionDict map[string]CompareFunc = map[string]CompareFunc{
-	"=":  cmpEqual,
-	"==": cmpEqual,
-	"<":  cmpLess,
-	">":  cmpLarge,
-	"<=": cmpLessEqual,
-	">=": cmpLargeEqual,
+	"=":       cmpEqual,
+	"==":      cmpEqual,
+	"!=":      cmpNotEqual,
+	"<":       cmpLess,
+	">":       cmpLarge,
+	"<=":      cmpLessEqual,
+	">=":      cmpLargeEqual,
+	"in":      cmpIn,
+	"not in":  cmpNotIn,
+	"between": cmpBetween,
+	"prefix":  cmpPrefix,
+}
+
+// operators are case insensitive, "NOT IN" is the same as "not  in"
+func cmpOperator(op string) string {
+	return strings.ToLower(strings.Join(strings.Fields(op), " "))
+}
+
+// pack several values into one Where value, for IN/NOT IN/BETWEEN
+func MakeValues(values ...[]byte) []byte {
+	v := make([]byte, 0, 20)
+	for i := range values {
+		v = MakeIndexKey(v, values[i])
+	}
+	return v
+}
+
+// unpack the values packed by MakeValues
+func SplitValues(v []byte) [][]byte {
+	if len(v) == 0 {
+		return nil
+	}
+	return SplitIndexKey(v)
 }
 
 type KVPair struct {
@@ -24,11 +54,20 @@ type KVPair struct {
 type QueryInfo struct {
 	IndexName string
 	Where     map[string][]byte //(fieldName, value)
+	Limit     int               //max objs returned, 0 means no limit
+	Cursor    string            //resume after the cursor returned by QueryPage
+	Partial   bool              //accept a partial index, which returns the objs its predicate holds only
 }
 
 type RangeInfo struct {
 	IndexName string
 	Where     map[string]map[string][]byte //(fieldName, value)
+	Reverse   bool                         //return in descending index order
+	Offset    int                          //skip the first Offset matched objs
+	Limit     int                          //max objs returned, 0 means no limit
+	Cursor    string                       //resume after the cursor returned by RangeQueryPage
+	Partial   bool                         //accept a partial index, which returns the objs its predicate holds only
+	Stats     *QueryStats                  //optional, count the index keys scanned, filtered out and records fetched
 }
 
 // check if data == v
@@ -55,6 +94,34 @@ func cmpLargeEqual(data, v []byte) bool {
 	return !cmpLess(data, v)
 }
 
+func cmpNotEqual(data, v []byte) bool {
+	return !cmpEqual(data, v)
+}
+
+// data is one of the values
+func cmpIn(data, v []byte) bool {
+	for _, value := range SplitValues(v) {
+		if bytes.Equal(data, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func cmpNotIn(data, v []byte) bool {
+	return !cmpIn(data, v)
+}
+
+// values[0] <= data <= values[1]
+func cmpBetween(data, v []byte) bool {
+	values := SplitValues(v)
+	return len(values) == 2 && cmpLargeEqual(data, values[0]) && cmpLessEqual(data, values[1])
+}
+
+func cmpPrefix(data, v []byte) bool {
+	return bytes.HasPrefix(data, v)
+}
+
 type cmpValueInfo struct {
 	value []byte
 	cmp   func(d, v []byte) bool
@@ -71,7 +138,7 @@ func (kvt *KVT) assignFieldsName(partial cmpQueryInfo, fieldValues [][]byte) (re
 	result = make(map[string][]byte, len(idx.Fields))
 
 	for i := range idx.Fields {
-		result[idx.Fields[i]] = fieldValues[i]
+		result[idx.Fields[i]] = idx.fieldValue(i, fieldValues[i])
 	}
 	return result
 }
@@ -120,16 +187,36 @@ func (kvt *KVT) getIndexInfo(name string) (index *IndexInfo, err error) {
 	return nil, fmt.Errorf(ErrIndexNotFound, name)
 }
 
-// query by index, and support fields range query
-func (kvt *KVT) RangeQuery(db Poler, rangeInfo RangeInfo) (result []any, err error) {
+// how to scan the index bucket for a range query
+// one prefix scan of the index
+type scanRange struct {
+	prefix []byte //index key prefix made up by the leading equal fields
+	start  []byte //lower bound(inclusive) from the first range field, nil means no limit
+	end    []byte //upper bound(exclusive) from the first range field, nil means no limit
+}
+
+type queryPlan struct {
+	index  *IndexInfo
+	ranges []scanRange //one scan for every combination of the IN values on the prefix fields, in key order
+	filter FilterFunc  //compare the left fields
+
+	prefixFields []string //fields in the prefix
+	filterFields []string //fields compared by the filter
+}
+
+// make up the index key prefixs and filter of the range query
+func (kvt *KVT) makeQueryPlan(rangeInfo RangeInfo) (*queryPlan, error) {
 
 	index, err := kvt.getIndexInfo(rangeInfo.IndexName)
 	if err != nil || index == nil {
 		return nil, fmt.Errorf(ErrIndexNotFound, rangeInfo.IndexName)
 	}
+	if index.Partial != nil && !rangeInfo.Partial {
+		return nil, fmt.Errorf(errIndexPartial, rangeInfo.IndexName)
+	}
 
-	//save all the equal query field with it's byte[] value
-	var equals map[string][]byte = make(map[string][]byte, len(index.Fields))
+	//save all the equal query field with it's byte[] values, IN gives several values
+	var equals map[string][][]byte = make(map[string][][]byte, len(index.Fields))
 
 	//check if fields info exists in index
 	for i := range rangeInfo.Where {
@@ -143,27 +230,30 @@ func (kvt *KVT) RangeQuery(db Poler, rangeInfo RangeInfo) (result []any, err err
 		if !found {
 			return nil, fmt.Errorf(errIndexFieldMismatch, i)
 		}
-		equals[i] = []byte{}
 		for j, v := range rangeInfo.Where[i] {
-			cmpMode := strings.TrimSpace(j)
-			_, ok := cmpFunctionDict[cmpMode]
+			cmpMode := cmpOperator(j)
+			_, ok := kvt.compareFunc(i, j)
 			if !ok {
 				return nil, fmt.Errorf(errCompareOperatorInvalid, j)
 			}
-			if (cmpMode == "=" || cmpMode == "==") && len(v) > 0 {
-				equals[i] = v
+			switch {
+			case (cmpMode == "=" || cmpMode == "==") && len(v) > 0:
+				equals[i] = [][]byte{v}
+			case cmpMode == "in" && len(equals[i]) == 0:
+				equals[i] = SplitValues(v)
 			}
 		}
 	}
 
-	prefix := make([]byte, 0)
+	prefixs := [][]byte{{}}
 
-	i := 0
+	i, prefixFields := 0, 0
 	partialQueryInfo := cmpQueryInfo{
 		IndexInfo: index,
 		Where:     make(map[string][]cmpValueInfo, len(index.Fields)),
 	}
 	partial := false
+	var prefixNames, filterFields []string
 	for i = range index.Fields {
 		name := index.Fields[i]
 		found, ok := rangeInfo.Where[name]
@@ -178,12 +268,24 @@ func (kvt *KVT) RangeQuery(db Poler, rangeInfo RangeInfo) (result []any, err err
 		}
 
 		if partial {
+			filterFields = append(filterFields, name)
 			for j := range found {
 				//here we have checked all the compare opereator is valid before
-				partialQueryInfo.Where[name] = append(partialQueryInfo.Where[name], cmpValueInfo{found[j], cmpFunctionDict[strings.TrimSpace(j)]})
+				cmp, _ := kvt.compareFunc(name, j)
+				value := collateWhere(index.collateAt(i), cmpOperator(j), found[j])
+				partialQueryInfo.Where[name] = append(partialQueryInfo.Where[name], cmpValueInfo{value, cmp})
 			}
 		} else {
-			prefix = MakeIndexKey(prefix, equals[name])
+			//every IN value makes a new prefix
+			next := make([][]byte, 0, len(prefixs)*len(equals[name]))
+			for _, prefix := range prefixs {
+				for _, v := range equals[name] {
+					next = append(next, MakeIndexKey(bytes.Clone(prefix), index.fieldKey(i, v)))
+				}
+			}
+			prefixs = next
+			prefixNames = append(prefixNames, name)
+			prefixFields++
 		}
 	}
 	filter := func(k []byte) bool {
@@ -195,40 +297,327 @@ func (kvt *KVT) RangeQuery(db Poler, rangeInfo RangeInfo) (result []any, err err
 		}
 	}
 
-	pks, err := db.Query(index.path, prefix, filter) //query (key, pk) pair
+	//the prefixs have the same fields count, so the scans in prefix order return the keys in order
+	slices.SortFunc(prefixs, bytes.Compare)
+	prefixs = slices.CompactFunc(prefixs, bytes.Equal)
+
+	plan := &queryPlan{index: index, filter: filter, prefixFields: prefixNames, filterFields: filterFields}
+	plan.ranges = make([]scanRange, len(prefixs))
+	for i := range prefixs {
+		plan.ranges[i].prefix = prefixs[i]
+		if prefixFields < len(index.Fields) {
+			makeRangeBound(index, &plan.ranges[i], prefixFields, rangeInfo.Where[index.Fields[prefixFields]])
+		}
+	}
+	return plan, nil
+}
+
+// push the compare of the first field after prefix down to the scan bound,
+// the filter still check them, the bound only narrow the keys to scan
+func makeRangeBound(index *IndexInfo, r *scanRange, pos int, where map[string][]byte) {
+	for op, v := range where {
+		op = cmpOperator(op)
+		v = collateWhere(index.collateAt(pos), op, v)
+		switch op {
+		case "between":
+			if b := SplitValues(v); len(b) == 2 {
+				r.bound(index, pos, ">=", b[0])
+				r.bound(index, pos, "<=", b[1])
+			}
+		case "prefix":
+			r.bound(index, pos, ">=", v)
+			if end := prefixEnd(v); end != nil {
+				r.bound(index, pos, "<", end)
+			}
+		default:
+			r.bound(index, pos, op, v)
+		}
+	}
+}
+
+// narrow the scan range by one compare of the field at pos, v is collated
+func (r *scanRange) bound(index *IndexInfo, pos int, op string, v []byte) {
+	stored := index.directValue(pos, v)
+
+	lower, upper := false, false
+	switch op {
+	case ">", ">=":
+		lower = true
+	case "<", "<=":
+		upper = true
+	}
+	if index.desc[pos] { //the stored bytes are in reverse order
+		lower, upper = upper, lower
+	}
+
+	switch {
+	case lower:
+		if start := lowerBound(r.prefix, stored); bytes.Compare(start, r.start) > 0 {
+			r.start = start
+		}
+	case upper:
+		if end := upperBound(r.prefix, stored); r.end == nil || bytes.Compare(end, r.end) < 0 {
+			r.end = end
+		}
+	}
+}
+
+// the opaque page cursor, made up by index name and the last index key seen
+func makeCursor(indexName string, key []byte) string {
+	raw := append(append([]byte(indexName), 0), key...)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
 
+// get the last index key from the cursor, it should belong to the index
+func parseCursor(indexName, cursor string) ([]byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
 	if err != nil {
-		return result, err
+		return nil, fmt.Errorf(errCursorInvalid, cursor)
 	}
+	name, key, ok := bytes.Cut(raw, []byte{0})
+	if !ok || string(name) != indexName {
+		return nil, fmt.Errorf(errCursorInvalid, cursor)
+	}
+	return key, nil
+}
 
-	for i := range pks {
-		v, err := db.Get(kvt.path, pks[i].Value)
+// scan the index with the plan, call fn with every matched (index key, pk) pair
+func (kvt *KVT) scanIndex(db Poler, rangeInfo RangeInfo, plan *queryPlan, fn ScanFunc) error {
+	return kvt.scanIndexValue(db, rangeInfo, plan, func(k, v []byte) bool {
+		pk, _ := plan.index.splitValue(v)
+		return fn(k, pk)
+	})
+}
+
+// scan the index with the plan, call fn with every matched (index key, index value) pair
+// resume after the Cursor, skip the first Offset matched, stop the scan after Limit matched or fn return false
+func (kvt *KVT) scanIndexValue(db Poler, rangeInfo RangeInfo, plan *queryPlan, fn ScanFunc) error {
+	skipped, matched := 0, 0
+	var after []byte
+	if len(rangeInfo.Cursor) > 0 {
+		var err error
+		if after, err = parseCursor(plan.index.Name, rangeInfo.Cursor); err != nil {
+			return err
+		}
+	}
+	stop := false
+	scan := func(k, v []byte) bool {
+		rangeInfo.Stats.count(1, 0, 0)
+		if !plan.filter(k) {
+			rangeInfo.Stats.count(0, 1, 0)
+			return true
+		}
+		if skipped < rangeInfo.Offset {
+			skipped++
+			return true
+		}
+		matched++
+		stop = !fn(k, v) || (rangeInfo.Limit > 0 && matched >= rangeInfo.Limit)
+		return !stop
+	}
+	//the ranges are in key order, scan them backward for a reverse query
+	for i := range plan.ranges {
+		r := plan.ranges[i]
+		if rangeInfo.Reverse {
+			r = plan.ranges[len(plan.ranges)-1-i]
+		}
+		info := ScanInfo{Prefix: r.prefix, Start: r.start, End: r.end, Reverse: rangeInfo.Reverse, After: after}
+		if err := db.Scan(plan.index.path, info, scan); err != nil || stop {
+			return err
+		}
+	}
+	return nil
+}
+
+// query by index, return the pks and the index keys matched
+func (kvt *KVT) rangePKs(db Poler, rangeInfo RangeInfo) (pks [][]byte, keys [][]byte, err error) {
+
+	plan, err := kvt.makeQueryPlan(rangeInfo)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	pks = make([][]byte, 0)
+	err = kvt.scanIndex(db, rangeInfo, plan, func(k, pk []byte) bool {
+		keys = append(keys, bytes.Clone(k[plan.index.offset:]))
+		pks = append(pks, bytes.Clone(pk))
+		return true
+	})
+	return pks, keys, err
+}
+
+// get the raw values of pks from data bucket
+func (kvt *KVT) getRaws(db Poler, pks [][]byte, stats *QueryStats) (result []KVPair, err error) {
+
+	result = make([]KVPair, 0, len(pks))
+	for i := range pks {
+		v, err := db.Get(kvt.path, pks[i])
 		if err != nil {
 			return result, err
 		}
-		if obj, err := kvt.unmarshal(v, nil); err == nil {
+		stats.count(0, 0, 1)
+		result = append(result, KVPair{Key: pks[i], Value: v})
+	}
+	return result, nil
+}
+
+// query by index, return the objs with their index keys, and all the index keys scanned,
+// the records missing or failed to decode are skipped, so objKeys may be shorter than keys
+func (kvt *KVT) rangeQuery(db Poler, rangeInfo RangeInfo) (result []any, objKeys, keys [][]byte, err error) {
+
+	pks, keys, err := kvt.rangePKs(db, rangeInfo)
+	if err != nil {
+		return result, nil, nil, err
+	}
+
+	raws, err := kvt.getRaws(db, pks, rangeInfo.Stats)
+	if err != nil {
+		return result, nil, nil, err
+	}
+
+	for i := range raws {
+		obj, err := kvt.tryLoad(raws[i].Key, raws[i].Value)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if obj != nil {
 			result = append(result, obj)
+			objKeys = append(objKeys, keys[i])
 		}
 	}
 
-	return result, nil
+	return result, objKeys, keys, nil
 }
 
-// simple query by the index, keys is the pairs of (fieldName, value []byte)
-// support fields equal only
-func (kvt *KVT) Query(db Poler, info QueryInfo) (result []any, err error) {
+// query by index, return the pks of matched objs only, never read the data bucket
+func (kvt *KVT) RangeQueryKeys(db Poler, rangeInfo RangeInfo) (pks [][]byte, err error) {
+	pks, _, err = kvt.rangePKs(db, rangeInfo)
+	return pks, err
+}
 
-	//convert to RangeInfo
+// query by index, return the (pk, raw value) pairs of matched objs without decode,
+// the raw value is decompressed if stored compressed, otherwise it has the same lifetime as the value returned by the db's Get
+func (kvt *KVT) RangeQueryRaw(db Poler, rangeInfo RangeInfo) (result []KVPair, err error) {
+	pks, _, err := kvt.rangePKs(db, rangeInfo)
+	if err != nil {
+		return nil, err
+	}
+	raws, err := kvt.getRaws(db, pks, rangeInfo.Stats)
+	if err != nil {
+		return nil, err
+	}
+	return kvt.unpackRaws(raws, 0)
+}
+
+// query by index, and support fields range query
+func (kvt *KVT) RangeQuery(db Poler, rangeInfo RangeInfo) (result []any, err error) {
+	result, _, _, err = kvt.rangeQuery(db, rangeInfo)
+	return result, err
+}
+
+// query a page of objs by index, give the returned cursor to RangeInfo.Cursor for the next page,
+// empty cursor means no more objs. the cursor is stable when data changes between pages
+func (kvt *KVT) RangeQueryPage(db Poler, rangeInfo RangeInfo) (result []any, cursor string, err error) {
+	limit := rangeInfo.Limit
+	if limit > 0 {
+		rangeInfo.Limit = limit + 1 //one more to check if next page exists
+	}
+	result, objKeys, keys, err := kvt.rangeQuery(db, rangeInfo)
+	if err != nil || limit <= 0 || len(keys) <= limit {
+		return result, "", err
+	}
+
+	if len(result) > limit { //resume after the last obj returned
+		return result[:limit], makeCursor(rangeInfo.IndexName, objKeys[limit-1]), nil
+	}
+	//some records are skipped, all the keys scanned are returned or skipped
+	return result, makeCursor(rangeInfo.IndexName, keys[len(keys)-1]), nil
+}
+
+func (info QueryInfo) rangeInfo() RangeInfo {
 	rangeInfo := RangeInfo{
 		IndexName: info.IndexName,
 		Where:     make(map[string]map[string][]byte, len(info.Where)),
+		Limit:     info.Limit,
+		Cursor:    info.Cursor,
+		Partial:   info.Partial,
 	}
 	for k, v := range info.Where {
 		rangeInfo.Where[k] = map[string][]byte{"=": v}
 	}
+	return rangeInfo
+}
+
+// simple query by the index, keys is the pairs of (fieldName, value []byte)
+// support fields equal only
+func (kvt *KVT) Query(db Poler, info QueryInfo) (result []any, err error) {
+	return kvt.RangeQuery(db, info.rangeInfo())
+}
+
+// simple query by the index, return the pks only, see RangeQueryKeys
+func (kvt *KVT) QueryKeys(db Poler, info QueryInfo) (pks [][]byte, err error) {
+	return kvt.RangeQueryKeys(db, info.rangeInfo())
+}
 
-	return kvt.RangeQuery(db, rangeInfo)
+// simple query by the index, return the raw values, see RangeQueryRaw
+func (kvt *KVT) QueryRaw(db Poler, info QueryInfo) (result []KVPair, err error) {
+	return kvt.RangeQueryRaw(db, info.rangeInfo())
+}
+
+// query a page of objs by the index, see RangeQueryPage
+func (kvt *KVT) QueryPage(db Poler, info QueryInfo) (result []any, cursor string, err error) {
+	return kvt.RangeQueryPage(db, info.rangeInfo())
+}
+
+// count the objs matched by index, from the index keys only, never read the data bucket.
+// an obj has one key in an index, but maybe several in a mindex, they are counted once by the pk,
+// Offset and Limit still count the index keys
+func (kvt *KVT) Count(db Poler, rangeInfo RangeInfo) (n int, err error) {
+
+	plan, err := kvt.makeQueryPlan(rangeInfo)
+	if err != nil {
+		return 0, err
+	}
+
+	//whole index bucket, one key for one obj
+	_, isIndex := kvt.indexs[rangeInfo.IndexName]
+	if c, ok := db.(Counter); ok && isIndex && len(rangeInfo.Where) == 0 &&
+		rangeInfo.Offset == 0 && rangeInfo.Limit == 0 && len(rangeInfo.Cursor) == 0 {
+		return c.Count(plan.index.path)
+	}
+
+	var seen map[string]struct{}
+	if !isIndex {
+		seen = make(map[string]struct{})
+	}
+	err = kvt.scanIndex(db, rangeInfo, plan, func(k, pk []byte) bool {
+		if seen != nil {
+			if _, ok := seen[string(pk)]; ok {
+				return true
+			}
+			seen[string(pk)] = struct{}{}
+		}
+		n++
+		return true
+	})
+	return n, err
+}
+
+// count the objs matched by the index with fields equal, see Count
+func (kvt *KVT) CountQuery(db Poler, info QueryInfo) (int, error) {
+	return kvt.Count(db, info.rangeInfo())
+}
+
+// count all the objs in data bucket, use the db's Counter if it provides
+func (kvt *KVT) CountAll(db Poler) (n int, err error) {
+	if c, ok := db.(Counter); ok {
+		return c.Count(kvt.path)
+	}
+	err = db.Scan(kvt.path, ScanInfo{}, func(k, v []byte) bool {
+		n++
+		return true
+	})
+	return n, err
 }
 
 // get a full obj with its pk only
@@ -240,7 +629,108 @@ func (kvt *KVT) Get(db Poler, obj KVer, dst KVer) (KVer, error) {
 	if err != nil || len(oldByte) == 0 {
 		return nil, fmt.Errorf(ErrDataNotFound)
 	}
-	return kvt.unmarshal(oldByte, dst)
+	return kvt.load(key, oldByte, dst)
+}
+
+// get the only obj owned by an unique index value, info should give all the index fields
+func (kvt *KVT) GetUnique(db Poler, info QueryInfo, dst KVer) (KVer, error) {
+
+	index, err := kvt.getIndexInfo(info.IndexName)
+	if err != nil {
+		return nil, err
+	}
+	if !index.Unique {
+		return nil, fmt.Errorf(errIndexNotUnique, info.IndexName)
+	}
+	if index.Partial != nil && !info.Partial {
+		return nil, fmt.Errorf(errIndexPartial, info.IndexName)
+	}
+
+	prefix := make([]byte, 0)
+	for i := range index.Fields {
+		v, ok := info.Where[index.Fields[i]]
+		if !ok {
+			return nil, fmt.Errorf(errIndexFieldMismatch, index.Fields[i])
+		}
+		prefix = MakeIndexKey(prefix, index.fieldKey(i, v))
+	}
+
+	pks, err := db.Query(index.path, prefix, func([]byte) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	if len(pks) == 0 {
+		return nil, fmt.Errorf(ErrDataNotFound)
+	}
+
+	pk, _ := index.splitValue(pks[0].Value)
+	v, err := db.Get(kvt.path, pk)
+	if err != nil || len(v) == 0 {
+		return nil, fmt.Errorf(ErrDataNotFound)
+	}
+	return kvt.load(pk, v, dst)
+}
+
+// iterate the objs matched by index one by one, stop when fn return false
+func (kvt *KVT) Iterate(db Poler, rangeInfo RangeInfo, fn IterFunc) error {
+
+	plan, err := kvt.makeQueryPlan(rangeInfo)
+	if err != nil {
+		return err
+	}
+
+	var getErr error
+	err = kvt.scanIndex(db, rangeInfo, plan, func(k, pk []byte) bool {
+		v, err := db.Get(kvt.path, pk)
+		if err != nil {
+			getErr = err
+			return false
+		}
+		rangeInfo.Stats.count(0, 0, 1)
+		obj, err := kvt.tryLoad(pk, v)
+		if err != nil {
+			getErr = err
+			return false
+		}
+		if obj != nil {
+			return fn(obj)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return getErr
+}
+
+// iterate all objs with prefixs/key bytes one by one, stop when fn return false
+func (kvt *KVT) IterateGets(db Poler, prefix []byte, fn IterFunc) error {
+
+	var loadErr error
+	err := db.Scan(kvt.path, ScanInfo{Prefix: prefix}, func(k, v []byte) bool {
+		obj, err := kvt.tryLoad(k[kvt.offset:], v)
+		if err != nil {
+			loadErr = err
+			return false
+		}
+		if obj != nil {
+			return fn(obj)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return loadErr
+}
+
+// get all (pk, raw value) pairs with prefixs/key bytes, without decode
+func (kvt *KVT) GetsRaw(db Poler, prefix []byte) (result []KVPair, err error) {
+	raws, err := db.Query(kvt.path, prefix, func([]byte) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	return kvt.unpackRaws(raws, kvt.offset)
 }
 
 // get all objs with prefixs/key bytes
@@ -252,7 +742,11 @@ func (kvt *KVT) Gets(db Poler, prefix []byte) (result []any, err error) {
 	}
 
 	for i := range pks {
-		if obj, err := kvt.unmarshal(pks[i].Value, nil); err == nil {
+		obj, err := kvt.tryLoad(pks[i].Key[kvt.offset:], pks[i].Value)
+		if err != nil {
+			return nil, err
+		}
+		if obj != nil {
 			result = append(result, obj)
 		}
 	}
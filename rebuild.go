@@ -0,0 +1,163 @@
+package kvt
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// report the rebuild progress, done records of total in current chunk
+type ProgressFunc = func(done, total int)
+
+// rebuild params, run it in several transactions with After = last returned pk for a large table
+type RebuildInfo struct {
+	Indexs   []string     //index or mindex names, empty means all
+	After    []byte       //resume after this primary key, nil means from the beginning, and clear the index buckets
+	Limit    int          //max records rebuilt in one call, 0 means no limit
+	Progress ProgressFunc //optional
+}
+
+// generate all index keys(without pk) of the obj for the index name, none if a partial index skips it
+func (kvt *KVT) makeIndexKeys(name string, obj KVer) (*IndexInfo, [][]byte, error) {
+	if v, ok := kvt.indexs[name]; ok {
+		if !v.indexed(obj) {
+			return v, nil, nil
+		}
+		ik, err := kvt.indexKey(obj, v)
+		if err != nil {
+			return v, nil, err
+		}
+		return v, [][]byte{ik}, nil
+	}
+	if v, ok := kvt.mindexs[name]; ok {
+		if !v.indexed(obj) {
+			return v.IndexInfo, nil, nil
+		}
+		iks, err := kvt.mindexKeys(obj, v)
+		if err != nil {
+			return v.IndexInfo, nil, err
+		}
+		return v.IndexInfo, iks, nil
+	}
+	return nil, nil, fmt.Errorf(ErrIndexNotFound, name)
+}
+
+func (kvt *KVT) allIndexNames() []string {
+	names := make([]string, 0, len(kvt.indexs)+len(kvt.mindexs))
+	for k := range kvt.indexs {
+		names = append(names, k)
+	}
+	for k := range kvt.mindexs {
+		names = append(names, k)
+	}
+	return names
+}
+
+// clear the index bucket, make sure it exists before delete
+func (kvt *KVT) resetIndexBucket(db Poler, index *IndexInfo) error {
+	if _, _, err := db.CreateBucket(index.path); err != nil {
+		return err
+	}
+	if err := db.DeleteBucket(index.path); err != nil {
+		return err
+	}
+	_, offset, err := db.CreateBucket(index.path)
+	if err != nil {
+		return err
+	}
+	index.offset = offset
+	return nil
+}
+
+// rebuild part of the index buckets from the data bucket,
+// return the last rebuilt pk to resume with, nil if all finished
+func (kvt *KVT) RebuildChunk(db Poler, info RebuildInfo) (last []byte, err error) {
+	names := info.Indexs
+	if len(names) == 0 {
+		names = kvt.allIndexNames()
+	}
+	indexs := make([]*IndexInfo, 0, len(names))
+	for i := range names {
+		index, err := kvt.getIndexInfo(names[i])
+		if err != nil {
+			return nil, err
+		}
+		indexs = append(indexs, index)
+	}
+
+	if info.After == nil {
+		for i := range indexs {
+			if err := kvt.resetIndexBucket(db, indexs[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	kvs, more, err := kvt.scanChunk(db, info.After, info.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	total := len(kvs)
+	for i := 0; i < total; i++ {
+		pk := kvs[i].Key
+		obj, err := kvt.load(pk, kvs[i].Value, nil)
+		if err != nil {
+			return last, err
+		}
+		for j := range names {
+			index, iks, err := kvt.makeIndexKeys(names[j], obj)
+			if err != nil {
+				return last, err
+			}
+			iv, err := index.indexValue(obj, pk)
+			if err != nil {
+				return last, err
+			}
+			for n := range iks {
+				if index.Unique {
+					if err := kvt.checkUniqueKey(db, index, iks[n], pk); err != nil {
+						return last, err
+					}
+				}
+				if err := db.Put(index.path, AppendLastKey(iks[n], pk), iv); err != nil {
+					return last, err
+				}
+			}
+		}
+		last = pk
+		if info.Progress != nil {
+			info.Progress(i+1, total)
+		}
+	}
+
+	if !more { //all finished
+		return nil, nil
+	}
+	return last, nil
+}
+
+// scan the next limit(0 means no limit) pairs of the data bucket after the pk, the keys are pks,
+// they are cloned to write the db after the scan, more is true if any pair is left
+func (kvt *KVT) scanChunk(db Poler, after []byte, limit int) (kvs []KVPair, more bool, err error) {
+	err = db.Scan(kvt.path, ScanInfo{After: after}, func(k, v []byte) bool {
+		if limit > 0 && len(kvs) == limit {
+			more = true
+			return false
+		}
+		kvs = append(kvs, KVPair{Key: bytes.Clone(k[kvt.offset:]), Value: bytes.Clone(v)})
+		return true
+	})
+	return kvs, more, err
+}
+
+// rebuild the index bucket named by name in one transaction
+func (kvt *KVT) RebuildIndex(db Poler, name string) error {
+	_, err := kvt.RebuildChunk(db, RebuildInfo{Indexs: []string{name}})
+	return err
+}
+
+// rebuild all the index and mindex buckets in one transaction
+func (kvt *KVT) RebuildIndexes(db Poler) error {
+	_, err := kvt.RebuildChunk(db, RebuildInfo{})
+	return err
+}
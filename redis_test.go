@@ -5,9 +5,11 @@ package kvt
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 	"unsafe"
@@ -1008,3 +1010,267 @@ func Test_BucketPath(t *testing.T) {
 	initkvt("a/b/bkt_Order13", "a/b/idx_Type_Status", "idx_Type_Status", []string{})
 	initkvt("a/b/bkt_Order14", "bkt_Order14/idx_Type_Status", "idx_Type_Status", []string{})
 }
+
+func Test_compareAndUpdateWatch(t *testing.T) {
+
+	bdb := redis.NewClient(&redis.Options{
+		Addr:     "localhost:6379",
+		Password: "",
+		DB:       0,
+	})
+	defer bdb.Close()
+
+	kp := KVTParam{Bucket: "Bucket_account"}
+	k, err := New(account{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+
+	_, err = bdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		p := NewRedisPoler(bdb, pipe, ctx)
+		k.DeleteDataBucket(p)
+		k.DeleteIndexBuckets(p)
+		return nil
+	})
+	_, err = bdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		p := NewRedisPoler(bdb, pipe, ctx)
+		k.CreateDataBucket(p)
+		k.CreateIndexBuckets(p)
+		return k.Insert(p, &account{ID: 1, Owner: "ann"})
+	})
+	if err != nil {
+		t.Errorf("insert fail: %s", err)
+		return
+	}
+
+	//read the account through the watching tx, and write it back if it's still the one read
+	update := func(tx *redis.Tx, expected KVer, fn func(a *account)) error {
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			p := NewRedisPoler(tx, pipe, ctx)
+			if expected == nil {
+				read, err := k.Get(p, &account{ID: 1}, nil)
+				if err != nil {
+					return err
+				}
+				expected = read
+			}
+			a := *expected.(*account)
+			fn(&a)
+			return k.CompareAndUpdate(p, &a, expected)
+		})
+		return err
+	}
+
+	//the other writer wins after the read, EXEC fails, and the stale obj conflicts at retry
+	var stale KVer
+	err = bdb.Watch(ctx, func(tx *redis.Tx) error {
+		stale, err = k.Get(NewRedisPoler(tx, nil, ctx), &account{ID: 1}, nil)
+		if err != nil {
+			return err
+		}
+		if err := bdb.Watch(ctx, func(other *redis.Tx) error {
+			return update(other, nil, func(a *account) { a.Balance = 100 })
+		}, kp.Bucket); err != nil {
+			t.Errorf("the other writer fail: %s", err)
+		}
+		return update(tx, stale, func(a *account) { a.Balance = 1 })
+	}, kp.Bucket)
+	if !errors.Is(err, redis.TxFailedErr) {
+		t.Errorf("the loser should fail with TxFailedErr: %v", err)
+	}
+	var conflict *ConflictError
+	err = bdb.Watch(ctx, func(tx *redis.Tx) error {
+		return update(tx, stale, func(a *account) { a.Balance = 1 })
+	}, kp.Bucket)
+	if !errors.As(err, &conflict) {
+		t.Errorf("the stale obj should fail with ConflictError: %v", err)
+	}
+
+	//concurrent writers add 1 each time, retry when another writer won, no add is lost
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				for {
+					err := bdb.Watch(ctx, func(tx *redis.Tx) error {
+						return update(tx, nil, func(a *account) { a.Balance++ })
+					}, kp.Bucket)
+					if errors.Is(err, redis.TxFailedErr) {
+						continue
+					}
+					if err != nil {
+						t.Errorf("concurrent update fail: %s", err)
+					}
+					break
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	read, err := k.Get(NewRedisPoler(bdb, nil, ctx), &account{ID: 1}, nil)
+	if err != nil || read.(*account).Balance != 140 {
+		t.Errorf("concurrent updates lost: %v %v", read, err)
+	}
+}
+
+func Test_scan(t *testing.T) {
+
+	bdb := redis.NewClient(&redis.Options{
+		Addr:     "localhost:6379",
+		Password: "",
+		DB:       0,
+	})
+	defer bdb.Close()
+
+	path := "Bucket_Scan"
+	bdb.Del(ctx, path)
+	_, err := bdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		p := NewRedisPoler(bdb, pipe, ctx)
+		p.CreateBucket(path)
+		for _, k := range []string{"b1", "a3", "c1", "a1", "b2", "a2"} {
+			p.Put(path, []byte(k), []byte("v"+k))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("put fail: %s", err)
+		return
+	}
+
+	p := NewRedisPoler(bdb, nil, ctx)
+	scan := func(info ScanInfo, limit int) []string {
+		keys := make([]string, 0)
+		err := p.Scan(path, info, func(k, v []byte) bool {
+			if string(v) != "v"+string(k) {
+				t.Errorf("scan value mismatch: %s %s", k, v)
+			}
+			keys = append(keys, string(k))
+			return limit == 0 || len(keys) < limit
+		})
+		if err != nil {
+			t.Errorf("scan fail: %s", err)
+		}
+		return keys
+	}
+
+	//redis hash has no order, the pairs are sorted before the scan
+	cases := []struct {
+		info  ScanInfo
+		limit int
+		keys  []string
+	}{
+		{ScanInfo{}, 0, []string{"a1", "a2", "a3", "b1", "b2", "c1"}},
+		{ScanInfo{Reverse: true}, 0, []string{"c1", "b2", "b1", "a3", "a2", "a1"}},
+		{ScanInfo{}, 2, []string{"a1", "a2"}},
+		{ScanInfo{Prefix: []byte("a")}, 0, []string{"a1", "a2", "a3"}},
+		{ScanInfo{Prefix: []byte("a"), Reverse: true}, 0, []string{"a3", "a2", "a1"}},
+		{ScanInfo{Prefix: []byte("*")}, 0, []string{}},
+		{ScanInfo{After: []byte("a2")}, 0, []string{"a3", "b1", "b2", "c1"}},
+		{ScanInfo{After: []byte("b1"), Reverse: true}, 0, []string{"a3", "a2", "a1"}},
+		{ScanInfo{After: []byte("a2"), Prefix: []byte("a")}, 0, []string{"a3"}},
+		{ScanInfo{Start: []byte("a2"), End: []byte("b2")}, 0, []string{"a2", "a3", "b1"}},
+		{ScanInfo{Start: []byte("a2"), End: []byte("b2"), Reverse: true}, 0, []string{"b1", "a3", "a2"}},
+		{ScanInfo{Start: []byte("a2"), End: []byte("b2"), After: []byte("a3")}, 0, []string{"b1"}},
+	}
+	for _, c := range cases {
+		if keys := scan(c.info, c.limit); !reflect.DeepEqual(keys, c.keys) {
+			t.Errorf("scan %+v mismatch: %v %v", c.info, keys, c.keys)
+		}
+	}
+
+	//the sequence is saved in the same hash, it's not counted
+	if n, err := p.(Counter).Count(path); err != nil || n != 6 {
+		t.Errorf("count fail: %d %v", n, err)
+	}
+
+	//pages, reverse pages and counts of the kvt
+	kp := KVTParam{
+		Bucket:    "Bucket_Member",
+		Unmarshal: memberUnmarshal,
+		Indexs: []IndexInfo{
+			{Name: "idx_Level_Score", Fields: []string{"Level", "Score"}},
+		},
+	}
+	k, err := New(member{}, &kp)
+	if err != nil {
+		t.Errorf("new kvt fail: %s", err)
+		return
+	}
+	bdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		p := NewRedisPoler(bdb, pipe, ctx)
+		k.DeleteDataBucket(p)
+		k.DeleteIndexBuckets(p)
+		return nil
+	})
+	ms := make([]member, 8)
+	_, err = bdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		p := NewRedisPoler(bdb, pipe, ctx)
+		k.CreateDataBucket(p)
+		k.CreateIndexBuckets(p)
+		for i := range ms {
+			ms[i] = member{ID: uint64(i + 1), Email: fmt.Sprintf("%d@a.com", i), Level: 1 + i/7, Score: float64(i * 10)}
+			if err := k.Put(p, &ms[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("put kvt fail: %s", err)
+		return
+	}
+
+	page := func(rangeInfo RangeInfo) (ids []uint64, cursor string) {
+		r, c, err := k.RangeQueryPage(p, rangeInfo)
+		if err != nil {
+			t.Errorf("query page fail: %s", err)
+		}
+		for i := range r {
+			ids = append(ids, r[i].(*member).ID)
+		}
+		return ids, c
+	}
+	rqi := RangeInfo{
+		IndexName: "idx_Level_Score",
+		Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(1)}},
+		Limit:     3,
+	}
+	for _, expect := range [][]uint64{{1, 2, 3}, {4, 5, 6}, {7}} {
+		ids, cursor := page(rqi)
+		if !reflect.DeepEqual(ids, expect) || (cursor == "") != (len(expect) < 3) {
+			t.Errorf("page mismatch: %v %v %s", ids, expect, cursor)
+		}
+		rqi.Cursor = cursor
+	}
+	rqi = RangeInfo{
+		IndexName: "idx_Level_Score",
+		Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(1)}, "Score": {">=": EncodeFloat64(20), "<": EncodeFloat64(60)}},
+		Reverse:   true,
+		Limit:     3,
+	}
+	ids, cursor := page(rqi)
+	if !reflect.DeepEqual(ids, []uint64{6, 5, 4}) || cursor == "" {
+		t.Errorf("reverse page 1 mismatch: %v %s", ids, cursor)
+	}
+	rqi.Cursor = cursor
+	if ids, cursor = page(rqi); !reflect.DeepEqual(ids, []uint64{3}) || cursor != "" {
+		t.Errorf("reverse page 2 mismatch: %v %s", ids, cursor)
+	}
+
+	if n, err := k.CountAll(p); err != nil || n != len(ms) {
+		t.Errorf("count all fail: %d %v", n, err)
+	}
+	if n, err := k.Count(p, RangeInfo{IndexName: "idx_Level_Score"}); err != nil || n != len(ms) {
+		t.Errorf("count index fail: %d %v", n, err)
+	}
+	if n, err := k.Count(p, RangeInfo{
+		IndexName: "idx_Level_Score",
+		Where:     map[string]map[string][]byte{"Level": {"=": EncodeInt64(1)}, "Score": {">": EncodeFloat64(10)}},
+	}); err != nil || n != 5 {
+		t.Errorf("count range fail: %d %v", n, err)
+	}
+}
@@ -0,0 +1,197 @@
+package kvt
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// T should be a pointer to the struct registered, like *order
+const errTableType = "table type invalid: [%s], should be a pointer to struct"
+
+// the decoded obj is not a T, the Unmarshal func returns another type
+const errTableObj = "table obj type mismatch: [%T], should be [%s]"
+
+// a typed DecodeFunc, dst is never nil, a new T is allocated when the caller gives none
+type TypedDecodeFunc[T KVer] func(b []byte, dst T) (T, error)
+
+// typed variant of IterFunc
+type TypedIterFunc[T KVer] func(obj T) bool
+
+// a typed layer over KVT, the objs returned are T instead of any,
+// the struct registered is taken from T, so they always match
+type Table[T KVer] struct {
+	kvt *KVT
+}
+
+// new a Table of T, decode is used instead of kp.Unmarshal if it's not nil, both nil means kp.Codec decodes
+func NewTable[T KVer](kp *KVTParam, decode TypedDecodeFunc[T]) (*Table[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Pointer || t.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf(errTableType, t)
+	}
+
+	param := *kp
+	if decode != nil {
+		param.Unmarshal = func(b []byte, dst KVer) (KVer, error) {
+			d, ok := dst.(T)
+			if !ok || reflect.ValueOf(d).IsNil() {
+				d = reflect.New(t.Elem()).Interface().(T)
+			}
+			return decode(b, d)
+		}
+	}
+	kvt, err := New(reflect.New(t.Elem()).Elem().Interface(), &param)
+	if err != nil {
+		return nil, err
+	}
+	return &Table[T]{kvt: kvt}, nil
+}
+
+// the untyped KVT, for the APIs without a typed variant
+func (t *Table[T]) KVT() *KVT {
+	return t.kvt
+}
+
+func (t *Table[T]) cast(obj any) (T, error) {
+	v, ok := obj.(T)
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf(errTableObj, obj, reflect.TypeOf((*T)(nil)).Elem())
+	}
+	return v, nil
+}
+
+func (t *Table[T]) castAll(objs []any, err error) ([]T, error) {
+	if err != nil {
+		return nil, err
+	}
+	result := make([]T, 0, len(objs))
+	for i := range objs {
+		v, err := t.cast(objs[i])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+func (t *Table[T]) Put(db Poler, obj T) error {
+	return t.kvt.Put(db, obj)
+}
+
+func (t *Table[T]) Delete(db Poler, obj T) error {
+	return t.kvt.Delete(db, obj)
+}
+
+// get the obj by the key of obj
+func (t *Table[T]) Get(db Poler, obj T) (T, error) {
+	v, err := t.kvt.Get(db, obj, nil)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return t.cast(v)
+}
+
+// get the only obj owned by an unique index value, see KVT.GetUnique
+func (t *Table[T]) GetUnique(db Poler, info QueryInfo) (T, error) {
+	v, err := t.kvt.GetUnique(db, info, nil)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return t.cast(v)
+}
+
+func (t *Table[T]) Query(db Poler, info QueryInfo) ([]T, error) {
+	return t.castAll(t.kvt.Query(db, info))
+}
+
+func (t *Table[T]) RangeQuery(db Poler, rangeInfo RangeInfo) ([]T, error) {
+	return t.castAll(t.kvt.RangeQuery(db, rangeInfo))
+}
+
+func (t *Table[T]) QueryPage(db Poler, info QueryInfo) ([]T, string, error) {
+	objs, cursor, err := t.kvt.QueryPage(db, info)
+	result, err := t.castAll(objs, err)
+	return result, cursor, err
+}
+
+func (t *Table[T]) RangeQueryPage(db Poler, rangeInfo RangeInfo) ([]T, string, error) {
+	objs, cursor, err := t.kvt.RangeQueryPage(db, rangeInfo)
+	result, err := t.castAll(objs, err)
+	return result, cursor, err
+}
+
+func (t *Table[T]) Gets(db Poler, prefix []byte) ([]T, error) {
+	return t.castAll(t.kvt.Gets(db, prefix))
+}
+
+func (t *Table[T]) Find(db Poler, where map[string]map[string][]byte) ([]T, *FindPlan, error) {
+	objs, plan, err := t.kvt.Find(db, where)
+	result, err := t.castAll(objs, err)
+	return result, plan, err
+}
+
+func (t *Table[T]) QueryTree(db Poler, node QueryNode) ([]T, error) {
+	return t.castAll(t.kvt.QueryTree(db, node))
+}
+
+// iterate the objs matched by index one by one, stop when fn return false
+func (t *Table[T]) Iterate(db Poler, rangeInfo RangeInfo, fn TypedIterFunc[T]) error {
+	var castErr error
+	err := t.kvt.Iterate(db, rangeInfo, func(obj KVer) bool {
+		v, err := t.cast(obj)
+		if err != nil {
+			castErr = err
+			return false
+		}
+		return fn(v)
+	})
+	if err != nil {
+		return err
+	}
+	return castErr
+}
+
+// iterate all objs with prefixs/key bytes one by one, stop when fn return false
+func (t *Table[T]) IterateGets(db Poler, prefix []byte, fn TypedIterFunc[T]) error {
+	var castErr error
+	err := t.kvt.IterateGets(db, prefix, func(obj KVer) bool {
+		v, err := t.cast(obj)
+		if err != nil {
+			castErr = err
+			return false
+		}
+		return fn(v)
+	})
+	if err != nil {
+		return err
+	}
+	return castErr
+}
+
+// write a new obj, see KVT.Insert
+func (t *Table[T]) Insert(db Poler, obj T) error {
+	return t.kvt.Insert(db, obj)
+}
+
+// replace a stored obj, see KVT.Update
+func (t *Table[T]) Update(db Poler, obj T) error {
+	return t.kvt.Update(db, obj)
+}
+
+func (t *Table[T]) Upsert(db Poler, obj T) error {
+	return t.kvt.Upsert(db, obj)
+}
+
+// replace the stored obj if it's still expected, see KVT.CompareAndUpdate
+func (t *Table[T]) CompareAndUpdate(db Poler, obj T, expected T) error {
+	return t.kvt.CompareAndUpdate(db, obj, expected)
+}
+
+// replace the stored obj if its version is still version, see KVT.UpdateVersion
+func (t *Table[T]) UpdateVersion(db Poler, obj T, version uint64) error {
+	return t.kvt.UpdateVersion(db, obj, version)
+}
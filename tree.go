@@ -0,0 +1,198 @@
+package kvt
+
+import (
+	"sort"
+)
+
+// a set of primary keys
+type pkSet map[string]struct{}
+
+// a node of the query tree, made up by Cond, And, Or and Not
+type QueryNode interface {
+	//the pk set of the node, negated means the node matches all the pks except the set
+	eval(kvt *KVT, db Poler) (set pkSet, negated bool, err error)
+}
+
+type condNode struct {
+	rangeInfo RangeInfo
+}
+
+type andNode []QueryNode
+
+type orNode []QueryNode
+
+type notNode struct {
+	node QueryNode
+}
+
+// a leaf of the query tree, the objs matched by one index range query
+func Cond(rangeInfo RangeInfo) QueryNode {
+	return condNode{rangeInfo}
+}
+
+// a leaf of the query tree, the objs matched by one index with fields equal
+func CondQuery(info QueryInfo) QueryNode {
+	return condNode{info.rangeInfo()}
+}
+
+// the objs matched by all the nodes
+func And(nodes ...QueryNode) QueryNode {
+	return andNode(nodes)
+}
+
+// the objs matched by any of the nodes
+func Or(nodes ...QueryNode) QueryNode {
+	return orNode(nodes)
+}
+
+// the objs not matched by the node
+func Not(node QueryNode) QueryNode {
+	return notNode{node}
+}
+
+func (n condNode) eval(kvt *KVT, db Poler) (pkSet, bool, error) {
+	pks, err := kvt.RangeQueryKeys(db, n.rangeInfo)
+	if err != nil {
+		return nil, false, err
+	}
+	set := make(pkSet, len(pks))
+	for i := range pks {
+		set[string(pks[i])] = struct{}{}
+	}
+	return set, false, nil
+}
+
+func (n notNode) eval(kvt *KVT, db Poler) (pkSet, bool, error) {
+	set, negated, err := n.node.eval(kvt, db)
+	return set, !negated, err
+}
+
+// intersect the positive sets, then remove the negated ones,
+// all negated: a AND NOT b = NOT (a OR b)
+func (n andNode) eval(kvt *KVT, db Poler) (pkSet, bool, error) {
+	var positive pkSet
+	negative := make(pkSet)
+	for _, node := range n {
+		set, negated, err := node.eval(kvt, db)
+		if err != nil {
+			return nil, false, err
+		}
+		switch {
+		case negated:
+			union(negative, set)
+		case positive == nil:
+			positive = set
+		default:
+			positive = intersect(positive, set)
+		}
+	}
+	if positive == nil {
+		return negative, true, nil
+	}
+	return subtract(positive, negative), false, nil
+}
+
+// union the positive sets, with negated ones: a OR NOT b = NOT (b - a)
+func (n orNode) eval(kvt *KVT, db Poler) (pkSet, bool, error) {
+	positive := make(pkSet)
+	var negative pkSet
+	for _, node := range n {
+		set, negated, err := node.eval(kvt, db)
+		if err != nil {
+			return nil, false, err
+		}
+		switch {
+		case !negated:
+			union(positive, set)
+		case negative == nil:
+			negative = set
+		default:
+			negative = intersect(negative, set)
+		}
+	}
+	if negative == nil {
+		return positive, false, nil
+	}
+	return subtract(negative, positive), true, nil
+}
+
+func union(dst, src pkSet) {
+	for k := range src {
+		dst[k] = struct{}{}
+	}
+}
+
+func intersect(a, b pkSet) pkSet {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	set := make(pkSet, len(a))
+	for k := range a {
+		if _, ok := b[k]; ok {
+			set[k] = struct{}{}
+		}
+	}
+	return set
+}
+
+func subtract(a, b pkSet) pkSet {
+	for k := range b {
+		delete(a, k)
+	}
+	return a
+}
+
+// query the pks matched by the query tree, in pk order,
+// only a negated root reads all the keys of the data bucket
+func (kvt *KVT) QueryTreeKeys(db Poler, node QueryNode) (pks [][]byte, err error) {
+	set, negated, err := node.eval(kvt, db)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(set))
+	if negated {
+		err = db.Scan(kvt.path, ScanInfo{}, func(k, v []byte) bool {
+			if _, ok := set[string(k[kvt.offset:])]; !ok {
+				keys = append(keys, string(k[kvt.offset:]))
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for k := range set {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	pks = make([][]byte, len(keys))
+	for i := range keys {
+		pks[i] = []byte(keys[i])
+	}
+	return pks, nil
+}
+
+// query the objs matched by the query tree, every obj is fetched once, in pk order
+func (kvt *KVT) QueryTree(db Poler, node QueryNode) (result []any, err error) {
+	pks, err := kvt.QueryTreeKeys(db, node)
+	if err != nil {
+		return nil, err
+	}
+	raws, err := kvt.getRaws(db, pks, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range raws {
+		obj, err := kvt.tryLoad(raws[i].Key, raws[i].Value)
+		if err != nil {
+			return nil, err
+		}
+		if obj != nil {
+			result = append(result, obj)
+		}
+	}
+	return result, nil
+}
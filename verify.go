@@ -0,0 +1,147 @@
+package kvt
+
+import (
+	"bytes"
+)
+
+type IssueKind int
+
+const (
+	IssueOrphan  IssueKind = iota //index key point to a pk not in data bucket
+	IssueMissing                  //index key of a record not found in index bucket
+	IssueStale                    //index key point to a record whose current index value differs
+)
+
+func (k IssueKind) String() string {
+	switch k {
+	case IssueOrphan:
+		return "orphan"
+	case IssueMissing:
+		return "missing"
+	case IssueStale:
+		return "stale"
+	}
+	return "unknown"
+}
+
+// one difference between the index bucket and the data bucket
+type IndexIssue struct {
+	Index string    //index or mindex name
+	Kind  IssueKind //
+	Key   []byte    //index key, with the pk suffix
+	PK    []byte    //primary key
+	value []byte    //expected index value, to repair the missing key
+}
+
+type VerifyReport struct {
+	Records   int          //records scanned in data bucket
+	IndexKeys int          //index keys scanned in all index buckets
+	Issues    []IndexIssue //
+	Repaired  bool         //all issues have been fixed
+}
+
+// true if no issue found
+func (r *VerifyReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// cross check every index and mindex bucket with the data bucket, read only
+func (kvt *KVT) Verify(db Poler) (*VerifyReport, error) {
+	return kvt.verify(db, false)
+}
+
+// verify and fix the differences, delete orphan/stale index keys and put the missing ones
+func (kvt *KVT) Repair(db Poler) (*VerifyReport, error) {
+	return kvt.verify(db, true)
+}
+
+func (kvt *KVT) verify(db Poler, repair bool) (*VerifyReport, error) {
+	report := &VerifyReport{}
+	names := kvt.allIndexNames()
+
+	//expected (index key, index value) of every index
+	expected := make(map[string]map[string][]byte, len(names))
+	for i := range names {
+		expected[names[i]] = make(map[string][]byte)
+	}
+	pks := make(map[string]struct{})
+
+	kvs, err := db.Query(kvt.path, nil, func([]byte) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	for i := range kvs {
+		obj, err := kvt.load(kvs[i].Key[kvt.offset:], kvs[i].Value, nil)
+		if err != nil {
+			return nil, err
+		}
+		pk := kvs[i].Key[kvt.offset:]
+		pks[string(pk)] = struct{}{}
+		for j := range names {
+			index, iks, err := kvt.makeIndexKeys(names[j], obj)
+			if err != nil {
+				return nil, err
+			}
+			iv, err := index.indexValue(obj, pk)
+			if err != nil {
+				return nil, err
+			}
+			for n := range iks {
+				expected[names[j]][string(AppendLastKey(iks[n], pk))] = iv
+			}
+		}
+	}
+	report.Records = len(kvs)
+
+	for i := range names {
+		index, err := kvt.getIndexInfo(names[i])
+		if err != nil {
+			return nil, err
+		}
+		iks, err := db.Query(index.path, nil, func([]byte) bool { return true })
+		if err != nil {
+			return nil, err
+		}
+		report.IndexKeys += len(iks)
+
+		exp := expected[names[i]]
+		for j := range iks {
+			ik, iv := iks[j].Key[index.offset:], iks[j].Value
+			if v, ok := exp[string(ik)]; ok && bytes.Equal(v, iv) {
+				delete(exp, string(ik))
+				continue
+			}
+			pk, _ := index.splitValue(iv)
+			kind := IssueOrphan
+			if _, ok := pks[string(pk)]; ok {
+				kind = IssueStale
+			}
+			//copy it, some db's key is only valid before the bucket changes
+			report.Issues = append(report.Issues, IndexIssue{names[i], kind, bytes.Clone(ik), bytes.Clone(pk), nil})
+		}
+		for k, iv := range exp {
+			pk, _ := index.splitValue(iv)
+			report.Issues = append(report.Issues, IndexIssue{names[i], IssueMissing, []byte(k), pk, iv})
+		}
+	}
+
+	if !repair || report.OK() {
+		return report, nil
+	}
+
+	for _, v := range report.Issues {
+		index, _ := kvt.getIndexInfo(v.Index)
+		switch v.Kind {
+		case IssueMissing:
+			err = db.Put(index.path, v.Key, v.value)
+		default:
+			err = db.Delete(index.path, v.Key)
+		}
+		if err != nil {
+			return report, err
+		}
+	}
+	report.Repaired = true
+
+	return report, nil
+}
@@ -0,0 +1,123 @@
+package kvt
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+const errRecordExists = "record already exists: key %v"
+
+const errRecordNotFound = "record not found: key %v"
+
+const errRecordConflict = "record changed: key %v, stored version %d"
+
+const errVersionMissing = "record has no version: [%T], it should implement Versioner"
+
+// check the stored record before write, old value and obj are nil if the pk is not stored
+type writeCheck = func(key, oldValue []byte, oldObj KVer) error
+
+// an obj with a version, UpdateVersion compares it with the stored one
+type Versioner interface {
+	Version() uint64
+}
+
+// Insert finds the pk stored already
+type ExistsError struct {
+	Key []byte
+}
+
+func (e *ExistsError) Error() string {
+	return fmt.Sprintf(errRecordExists, e.Key)
+}
+
+// Update finds no record of the pk
+type NotFoundError struct {
+	Key []byte
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf(errRecordNotFound, e.Key)
+}
+
+// the stored record is not the expected one, another writer changed it
+type ConflictError struct {
+	Key     []byte
+	Version uint64 //the stored version, UpdateVersion only
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf(errRecordConflict, e.Key, e.Version)
+}
+
+func checkNotExists(key, oldValue []byte, oldObj KVer) error {
+	if oldObj != nil {
+		return &ExistsError{Key: bytes.Clone(key)}
+	}
+	return nil
+}
+
+func checkExists(key, oldValue []byte, oldObj KVer) error {
+	if oldObj == nil {
+		return &NotFoundError{Key: bytes.Clone(key)}
+	}
+	return nil
+}
+
+// write a new obj, fail with ExistsError if its pk is stored
+func (kvt *KVT) Insert(db Poler, obj KVer) error {
+	return kvt.put(db, obj, checkNotExists)
+}
+
+// replace a stored obj, fail with NotFoundError if its pk is not stored
+func (kvt *KVT) Update(db Poler, obj KVer) error {
+	return kvt.put(db, obj, checkExists)
+}
+
+// insert or update the obj, the same as Put
+func (kvt *KVT) Upsert(db Poler, obj KVer) error {
+	return kvt.put(db, obj, nil)
+}
+
+// replace the stored obj only if it's still the expected one, the obj read before,
+// fail with ConflictError if not. expected is decoded from its own value before compared with the stored obj,
+// so the codec needn't be deterministic, gob writes the maps in random order.
+// the check and write are atomic in a bolt/bunt write transaction. for redis, read through the *redis.Tx of
+// client.Watch(ctx, fn, dataBucket), and write in its TxPipelined, EXEC fails with redis.TxFailedErr if another writer won
+func (kvt *KVT) CompareAndUpdate(db Poler, obj KVer, expected KVer) error {
+	want, err := kvt.value(expected)
+	if err != nil {
+		return err
+	}
+	wantObj, err := kvt.unmarshal(want, nil)
+	if err != nil {
+		return err
+	}
+	return kvt.put(db, obj, func(key, oldValue []byte, oldObj KVer) error {
+		if err := checkExists(key, oldValue, oldObj); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(oldObj, wantObj) {
+			return &ConflictError{Key: bytes.Clone(key)}
+		}
+		return nil
+	})
+}
+
+// replace the stored obj only if its Version() is still version, the obj should implement Versioner,
+// and carry its new version, fail with ConflictError if another writer changed it. see CompareAndUpdate for atomicity
+func (kvt *KVT) UpdateVersion(db Poler, obj KVer, version uint64) error {
+	return kvt.put(db, obj, func(key, oldValue []byte, oldObj KVer) error {
+		if err := checkExists(key, oldValue, oldObj); err != nil {
+			return err
+		}
+		v, ok := oldObj.(Versioner)
+		if !ok {
+			return fmt.Errorf(errVersionMissing, oldObj)
+		}
+		if v.Version() != version {
+			return &ConflictError{Key: bytes.Clone(key), Version: v.Version()}
+		}
+		return nil
+	})
+}